@@ -0,0 +1,342 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var aliasForce bool
+
+// aliasTypes are the kinds of objects an alias can point to
+var aliasTypes = []string{"room", "team", "person"}
+
+// aliasFlags are the flags taking an ID, where @name is replaced by the ID of the alias
+var aliasFlags = map[string]bool{
+	"id": true, "i": true, "room": true, "roomID": true, "rooms": true, "team": true, "person-id": true, "from": true,
+}
+
+// aliasSlugRegexp matches the characters replaced by a dash in the alias names imported from room titles
+var aliasSlugRegexp = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Alias is a local name for a room, a team or a person
+type Alias struct {
+	Name string `json:"name" csv:"name"`
+	Type string `json:"type" csv:"type"`
+	ID   string `json:"id" csv:"id"`
+}
+
+// readAliases returns the aliases of the config file, by name
+func readAliases() map[string]string {
+	return viper.GetStringMapString("aliases")
+}
+
+// parseAliasTarget splits an alias target, room:<id>, into its type and ID
+func parseAliasTarget(target string) (string, string, error) {
+	parts := strings.SplitN(target, ":", 2)
+	if len(parts) == 2 {
+		for _, aliasType := range aliasTypes {
+			if parts[0] == aliasType && parts[1] != "" {
+				return parts[0], parts[1], nil
+			}
+		}
+	}
+	return "", "", fmt.Errorf("invalid alias target %q, use room:<id>, team:<id> or person:<id>", target)
+}
+
+// ExpandAlias returns the ID of an @name alias, or the value itself when it is not an alias
+func ExpandAlias(value string) (string, error) {
+	if !strings.HasPrefix(value, "@") {
+		return value, nil
+	}
+	target, ok := readAliases()[strings.ToLower(value[1:])]
+	if !ok {
+		return "", fmt.Errorf("unknown alias %s, see go-spark alias list", value)
+	}
+	_, id, err := parseAliasTarget(target)
+	return id, err
+}
+
+// expandAliasFlags replaces the @name aliases given to the ID flags of the command
+func expandAliasFlags(cmd *cobra.Command) {
+	cmd.Flags().Visit(func(flag *pflag.Flag) {
+		if !aliasFlags[flag.Name] {
+			return
+		}
+		if !strings.Contains(flag.Value.String(), "@") {
+			return
+		}
+		var values []string
+		for _, value := range strings.Split(flag.Value.String(), ",") {
+			id, err := ExpandAlias(strings.TrimSpace(value))
+			if err != nil {
+				log.Fatal(err)
+			}
+			values = append(values, id)
+		}
+		flag.Value.Set(strings.Join(values, ","))
+	})
+}
+
+// resolveAliasTarget checks that the target exists and returns it with its ID, resolving room and person names
+func resolveAliasTarget(target string) (string, error) {
+	aliasType, value, err := parseAliasTarget(target)
+	if err != nil {
+		return "", err
+	}
+
+	var id string
+	switch aliasType {
+	case "room":
+		if id, err = ResolveRoomID(value); err == nil {
+			_, _, err = SparkClient.Rooms.GetRoom(id)
+		}
+	case "team":
+		id = value
+		_, _, err = SparkClient.Teams.GetTeam(id)
+	case "person":
+		person, resolveErr := ResolvePerson(value)
+		if err = resolveErr; err == nil {
+			id = person.ID
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", target, err)
+	}
+	return aliasType + ":" + id, nil
+}
+
+// writeAliases saves the aliases in the config file, keeping its other settings.
+// The file is edited directly so the values read from the environment, such as the token, are not written to it.
+func writeAliases(aliases map[string]string) error {
+	path := viper.ConfigFileUsed()
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(home, ".go-spark.yaml")
+	}
+
+	config := make(map[string]interface{})
+	content, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	isJSON := ext == ".json"
+	switch {
+	case ext != ".json" && ext != ".yaml" && ext != ".yml":
+		return fmt.Errorf("%s: aliases can only be saved in a YAML or JSON config file", path)
+	case len(content) == 0:
+	case isJSON:
+		err = json.Unmarshal(content, &config)
+	default:
+		var yamlConfig interface{}
+		if err = yaml.Unmarshal(content, &yamlConfig); err == nil && yamlConfig != nil {
+			config, _ = convertYAML(yamlConfig).(map[string]interface{})
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	if config == nil {
+		config = make(map[string]interface{})
+	}
+	config["aliases"] = aliases
+	if isJSON {
+		content, err = json.MarshalIndent(config, "", "  ")
+	} else {
+		content, err = yaml.Marshal(config)
+	}
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, content, 0600); err != nil {
+		return err
+	}
+	viper.Set("aliases", aliases)
+	return nil
+}
+
+// aliasSlug returns an alias name for a room title
+func aliasSlug(title string) string {
+	return strings.Trim(aliasSlugRegexp.ReplaceAllString(strings.ToLower(title), "-"), "-")
+}
+
+// aliasCmd represents the alias command
+var aliasCmd = &cobra.Command{
+	Use:   "alias",
+	Short: "Local names for rooms, teams and people",
+	Long: `Aliases are local names for rooms, teams and people, saved in the config file.
+
+Use an alias as @name in any ID flag, for example go-spark messages send -r @ops -T "Deployed".`,
+}
+
+// aliasSetCmd represents the alias set command
+var aliasSetCmd = &cobra.Command{
+	Use:   "set <name> <room|team|person>:<target>",
+	Short: "Create or replace an alias",
+	Long: `Creates or replaces an alias.
+
+The target is room:<ID or name>, team:<ID> or person:<ID, email address, display name or me>.
+The target is checked and saved by ID.
+
+Example: go-spark alias set ops "room:Ops Incidents"`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := strings.ToLower(strings.TrimPrefix(args[0], "@"))
+		target, err := resolveAliasTarget(args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		aliases := readAliases()
+		aliases[name] = target
+		if err := writeAliases(aliases); err != nil {
+			log.Fatal(err)
+		}
+		aliasType, id, _ := parseAliasTarget(target)
+		PrintResponseFormat(&Alias{Name: name, Type: aliasType, ID: id})
+	},
+}
+
+// aliasListCmd represents the alias list command
+var aliasListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the aliases",
+	Long:  `Lists the aliases, by name.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		aliases := readAliases()
+		var list []*Alias
+		for name, target := range aliases {
+			aliasType, id, err := parseAliasTarget(target)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "@%s: %v\n", name, err)
+				continue
+			}
+			list = append(list, &Alias{Name: name, Type: aliasType, ID: id})
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+		PrintResponseFormat(list)
+	},
+}
+
+// aliasDeleteCmd represents the alias delete command
+var aliasDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete an alias",
+	Long:  `Deletes an alias, by name.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := strings.ToLower(strings.TrimPrefix(args[0], "@"))
+		aliases := readAliases()
+		if _, ok := aliases[name]; !ok {
+			log.Fatalf("unknown alias @%s", name)
+		}
+		delete(aliases, name)
+		if err := writeAliases(aliases); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// aliasImportCmd represents the alias import command
+var aliasImportCmd = &cobra.Command{
+	Use:   "import [file]",
+	Short: "Create aliases for rooms",
+	Long: `Creates an alias for every room of the JSON output of go-spark rooms list, read from the file or from stdin.
+The alias names are the room titles in lowercase, with dashes instead of spaces and punctuation.
+
+Existing aliases are kept unless --force is used.
+
+Example: go-spark rooms list -m 100 | go-spark alias import`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var content []byte
+		var err error
+		if len(args) == 1 {
+			content, err = ioutil.ReadFile(args[0])
+		} else {
+			content, err = ioutil.ReadAll(os.Stdin)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		var rooms []*SparkRoom
+		if err := json.Unmarshal(content, &rooms); err != nil {
+			log.Fatalf("the rooms must be the JSON output of go-spark rooms list: %v", err)
+		}
+
+		aliases := readAliases()
+		var imported []*Alias
+		for _, room := range rooms {
+			name := aliasSlug(room.Title)
+			if name == "" || room.ID == "" {
+				continue
+			}
+			if _, ok := aliases[name]; ok && !aliasForce {
+				fmt.Fprintf(os.Stderr, "Skipping @%s, it already exists\n", name)
+				continue
+			}
+			aliases[name] = "room:" + room.ID
+			imported = append(imported, &Alias{Name: name, Type: "room", ID: room.ID})
+		}
+		if err := writeAliases(aliases); err != nil {
+			log.Fatal(err)
+		}
+		PrintResponseFormat(imported)
+	},
+}
+
+// aliasCheckCmd represents the alias check command
+var aliasCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check that the aliases still exist",
+	Long:  `Checks that the room, team or person of every alias still exists, and exits with 1 when one does not.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		aliases := readAliases()
+		names := make([]string, 0, len(aliases))
+		for name := range aliases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		failed := false
+		for _, name := range names {
+			if _, err := resolveAliasTarget(aliases[name]); err != nil {
+				fmt.Printf("@%s: %v\n", name, err)
+				failed = true
+				continue
+			}
+			fmt.Printf("@%s: ok\n", name)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(aliasCmd)
+	aliasCmd.AddCommand(aliasSetCmd)
+	aliasCmd.AddCommand(aliasListCmd)
+	aliasCmd.AddCommand(aliasDeleteCmd)
+	aliasCmd.AddCommand(aliasImportCmd)
+	aliasCmd.AddCommand(aliasCheckCmd)
+
+	aliasImportCmd.Flags().BoolVar(&aliasForce, "force", false, "Replace the existing aliases.")
+}
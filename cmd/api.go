@@ -0,0 +1,614 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/jbogarin/go-cisco-spark/ciscospark"
+)
+
+// Attachment is a message attachment, such as an Adaptive Card
+type Attachment struct {
+	ContentType string      `json:"contentType"`
+	Content     interface{} `json:"content"`
+}
+
+// SparkMessage is a message with the fields not yet exposed by ciscospark.Message
+type SparkMessage struct {
+	ID              string       `json:"id,omitempty"`
+	ParentID        string       `json:"parentId,omitempty"`
+	RoomID          string       `json:"roomId,omitempty"`
+	RoomType        string       `json:"roomType,omitempty"`
+	ToPersonID      string       `json:"toPersonId,omitempty"`
+	ToPersonEmail   string       `json:"toPersonEmail,omitempty"`
+	Text            string       `json:"text,omitempty"`
+	MarkDown        string       `json:"markdown,omitempty"`
+	HTML            string       `json:"html,omitempty"`
+	Files           []string     `json:"files,omitempty"`
+	Attachments     []Attachment `json:"attachments,omitempty"`
+	PersonID        string       `json:"personId,omitempty"`
+	PersonEmail     string       `json:"personEmail,omitempty"`
+	MentionedPeople []string     `json:"mentionedPeople,omitempty"`
+	MentionedGroups []string     `json:"mentionedGroups,omitempty"`
+	Created         *time.Time   `json:"created,omitempty"`
+	Updated         *time.Time   `json:"updated,omitempty"`
+}
+
+// SparkMessageRequest is a message request with the fields not yet exposed by ciscospark.MessageRequest
+type SparkMessageRequest struct {
+	RoomID        string       `json:"roomId,omitempty"`
+	ParentID      string       `json:"parentId,omitempty"`
+	ToPersonID    string       `json:"toPersonId,omitempty"`
+	ToPersonEmail string       `json:"toPersonEmail,omitempty"`
+	Text          string       `json:"text,omitempty"`
+	MarkDown      string       `json:"markdown,omitempty"`
+	Files         []string     `json:"files,omitempty"`
+	Attachments   []Attachment `json:"attachments,omitempty"`
+}
+
+// PostSparkMessage posts a message request through the raw messages API
+func PostSparkMessage(messageRequest *SparkMessageRequest) (*SparkMessage, error) {
+	message, _, err := postSparkMessage(messageRequest)
+	return message, err
+}
+
+// PostSparkMessageWithRetry posts a message through the rate limiter, retrying when the request is rate limited
+func PostSparkMessageWithRetry(limiter *RateLimiter, messageRequest *SparkMessageRequest) (*SparkMessage, error) {
+	for {
+		limiter.Wait()
+		message, response, err := postSparkMessage(messageRequest)
+		if IsRateLimited(response) {
+			time.Sleep(RetryAfter(response, 10*time.Second))
+			continue
+		}
+		return message, err
+	}
+}
+
+// postSparkMessage posts a message request and returns the response
+func postSparkMessage(messageRequest *SparkMessageRequest) (*SparkMessage, *ciscospark.Response, error) {
+	request, err := SparkClient.NewRequest("POST", "messages", messageRequest)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	message := new(SparkMessage)
+	response, err := SparkClient.Do(request, message)
+	if verbose && response != nil {
+		PrintRequestWithBody(response.Request, messageRequest)
+	}
+	if err != nil {
+		return nil, response, err
+	}
+	return message, response, nil
+}
+
+// sparkMessagesPage is a page of messages returned by the raw messages API
+type sparkMessagesPage struct {
+	Items []*SparkMessage `json:"items"`
+}
+
+// ListSparkMessages lists the messages of a room through the raw messages API, newest first
+func ListSparkMessages(queryParams *ciscospark.MessageQueryParams) ([]*SparkMessage, *ciscospark.Response, error) {
+	query := url.Values{}
+	query.Set("roomId", queryParams.RoomID)
+	if queryParams.Max > 0 {
+		query.Set("max", strconv.Itoa(queryParams.Max))
+	}
+	if queryParams.Before != "" {
+		query.Set("before", queryParams.Before)
+	}
+	if queryParams.BeforeMessage != "" {
+		query.Set("beforeMessage", queryParams.BeforeMessage)
+	}
+	if queryParams.MentionedPeople != "" {
+		query.Set("mentionedPeople", queryParams.MentionedPeople)
+	}
+
+	request, err := SparkClient.NewRequest("GET", "messages?"+query.Encode(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	page := new(sparkMessagesPage)
+	response, err := SparkClient.Do(request, page)
+	if verbose && response != nil {
+		PrintRequestWithoutBody(response.Request)
+	}
+	if err != nil {
+		return nil, response, err
+	}
+	return page.Items, response, nil
+}
+
+// GetSparkMessage shows the details of a message through the raw messages API
+func GetSparkMessage(id string) (*SparkMessage, error) {
+	request, err := SparkClient.NewRequest("GET", "messages/"+id, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	message := new(SparkMessage)
+	response, err := SparkClient.Do(request, message)
+	if verbose && response != nil {
+		PrintRequestWithoutBody(response.Request)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// IsRateLimited returns true when the request was rejected with 429 Too Many Requests
+func IsRateLimited(response *ciscospark.Response) bool {
+	return response != nil && response.Response != nil && response.StatusCode == http.StatusTooManyRequests
+}
+
+// RetryAfter returns the wait requested by the Retry-After header, or the fallback when it is missing
+func RetryAfter(response *ciscospark.Response, fallback time.Duration) time.Duration {
+	if response == nil || response.Response == nil {
+		return fallback
+	}
+	seconds, err := strconv.Atoi(response.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return fallback
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// DownloadFile downloads a message file into the directory and returns the path of the downloaded file.
+// Files already downloaded are not downloaded again.
+func DownloadFile(fileURL, dir string) (string, error) {
+	request, err := http.NewRequest("GET", fileURL, nil)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Authorization", SparkClient.Authorization)
+
+	hash := sha1.Sum([]byte(fileURL))
+	prefix := hex.EncodeToString(hash[:])[:8]
+	matches, _ := filepath.Glob(filepath.Join(dir, prefix+"-*"))
+	for _, match := range matches {
+		if filepath.Ext(match) != ".part" {
+			return match, nil
+		}
+	}
+
+	response, err := HTTPClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if verbose {
+		PrintRequestWithoutBody(request)
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to download %s: %s", fileURL, response.Status)
+	}
+
+	name := path.Base(request.URL.Path)
+	if _, params, err := mime.ParseMediaType(response.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		name = filepath.Base(params["filename"])
+	}
+
+	filePath := filepath.Join(dir, prefix+"-"+name)
+	file, err := os.Create(filePath + ".part")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(file, response.Body)
+	file.Close()
+	if err != nil {
+		return "", err
+	}
+	return filePath, os.Rename(filePath+".part", filePath)
+}
+
+// SparkRoom is a room with the fields not yet exposed by ciscospark.Room
+type SparkRoom struct {
+	ID           string     `json:"id,omitempty"`
+	Title        string     `json:"title,omitempty"`
+	Type         string     `json:"type,omitempty"`
+	IsLocked     bool       `json:"isLocked,omitempty"`
+	TeamID       string     `json:"teamId,omitempty"`
+	CreatorID    string     `json:"creatorId,omitempty"`
+	LastActivity *time.Time `json:"lastActivity,omitempty"`
+	Created      *time.Time `json:"created,omitempty"`
+}
+
+// linkNextRegexp matches the next page in a Link header
+var linkNextRegexp = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// itemsPage is a page of items returned by the list APIs
+type itemsPage struct {
+	Items []json.RawMessage `json:"items"`
+}
+
+// listAllPages requests every page of a list API, following the Link headers, and calls fn with the items of each page
+func listAllPages(urlStr string, fn func(items []json.RawMessage) error) error {
+	for urlStr != "" {
+		request, err := SparkClient.NewRequest("GET", urlStr, nil)
+		if err != nil {
+			return err
+		}
+
+		page := new(itemsPage)
+		response, err := SparkClient.Do(request, page)
+		if verbose && response != nil {
+			PrintRequestWithoutBody(response.Request)
+		}
+		if IsRateLimited(response) {
+			time.Sleep(RetryAfter(response, 10*time.Second))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(page.Items); err != nil {
+			return err
+		}
+
+		urlStr = ""
+		if match := linkNextRegexp.FindStringSubmatch(response.Header.Get("Link")); match != nil {
+			urlStr = match[1]
+		}
+	}
+	return nil
+}
+
+// ListAllRooms lists every room of the authenticated user, following the pagination
+func ListAllRooms(queryParams *ciscospark.RoomQueryParams) ([]*SparkRoom, error) {
+	query := url.Values{}
+	query.Set("max", "1000")
+	if queryParams != nil && queryParams.Type != "" {
+		query.Set("type", queryParams.Type)
+	}
+	if queryParams != nil && queryParams.TeamID != "" {
+		query.Set("teamId", queryParams.TeamID)
+	}
+
+	var rooms []*SparkRoom
+	err := listAllPages("rooms?"+query.Encode(), func(items []json.RawMessage) error {
+		for _, item := range items {
+			room := new(SparkRoom)
+			if err := json.Unmarshal(item, room); err != nil {
+				return err
+			}
+			rooms = append(rooms, room)
+		}
+		return nil
+	})
+	return rooms, err
+}
+
+// GetSparkRoom shows the details of a room through the raw rooms API
+func GetSparkRoom(id string) (*SparkRoom, error) {
+	request, err := SparkClient.NewRequest("GET", "rooms/"+id, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	room := new(SparkRoom)
+	response, err := SparkClient.Do(request, room)
+	if verbose && response != nil {
+		PrintRequestWithoutBody(response.Request)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+// SparkMembership is a room membership with the fields not yet exposed by ciscospark.Membership
+type SparkMembership struct {
+	ID                string     `json:"id,omitempty"`
+	RoomID            string     `json:"roomId,omitempty"`
+	PersonID          string     `json:"personId,omitempty"`
+	PersonEmail       string     `json:"personEmail,omitempty"`
+	PersonDisplayName string     `json:"personDisplayName,omitempty"`
+	PersonOrgID       string     `json:"personOrgId,omitempty"`
+	IsModerator       bool       `json:"isModerator,omitempty"`
+	IsMonitor         bool       `json:"isMonitor,omitempty"`
+	Created           *time.Time `json:"created,omitempty"`
+}
+
+// ListAllMemberships lists every membership of a room, following the pagination
+func ListAllMemberships(roomID string) ([]*SparkMembership, error) {
+	query := url.Values{}
+	query.Set("roomId", roomID)
+	query.Set("max", "1000")
+
+	var memberships []*SparkMembership
+	err := listAllPages("memberships?"+query.Encode(), func(items []json.RawMessage) error {
+		for _, item := range items {
+			membership := new(SparkMembership)
+			if err := json.Unmarshal(item, membership); err != nil {
+				return err
+			}
+			memberships = append(memberships, membership)
+		}
+		return nil
+	})
+	return memberships, err
+}
+
+// ListAllTeams lists every team of the authenticated user, following the pagination
+func ListAllTeams() ([]*ciscospark.Team, error) {
+	var teams []*ciscospark.Team
+	err := listAllPages("teams?max=1000", func(items []json.RawMessage) error {
+		for _, item := range items {
+			team := new(ciscospark.Team)
+			if err := json.Unmarshal(item, team); err != nil {
+				return err
+			}
+			teams = append(teams, team)
+		}
+		return nil
+	})
+	return teams, err
+}
+
+// ListAllTeamMemberships lists every membership of a team, following the pagination
+func ListAllTeamMemberships(teamID string) ([]*ciscospark.TeamMembership, error) {
+	query := url.Values{}
+	query.Set("teamId", teamID)
+	query.Set("max", "1000")
+
+	var memberships []*ciscospark.TeamMembership
+	err := listAllPages("team/memberships?"+query.Encode(), func(items []json.RawMessage) error {
+		for _, item := range items {
+			membership := new(ciscospark.TeamMembership)
+			if err := json.Unmarshal(item, membership); err != nil {
+				return err
+			}
+			memberships = append(memberships, membership)
+		}
+		return nil
+	})
+	return memberships, err
+}
+
+// RateLimiter spaces the requests made by concurrent workers
+type RateLimiter struct {
+	ticker *time.Ticker
+}
+
+// NewRateLimiter returns a rate limiter allowing perSecond requests every second
+func NewRateLimiter(perSecond float64) *RateLimiter {
+	if perSecond <= 0 {
+		perSecond = 1
+	}
+	return &RateLimiter{ticker: time.NewTicker(time.Duration(float64(time.Second) / perSecond))}
+}
+
+// Wait blocks until the next request is allowed
+func (l *RateLimiter) Wait() {
+	<-l.ticker.C
+}
+
+// ListSparkMessagesWithRetry lists messages through the rate limiter, retrying when the request is rate limited
+func ListSparkMessagesWithRetry(limiter *RateLimiter, queryParams *ciscospark.MessageQueryParams) ([]*SparkMessage, error) {
+	for {
+		limiter.Wait()
+		messages, response, err := ListSparkMessages(queryParams)
+		if IsRateLimited(response) {
+			time.Sleep(RetryAfter(response, 10*time.Second))
+			continue
+		}
+		return messages, err
+	}
+}
+
+// DeleteMembershipWithRetry deletes a membership through the rate limiter, retrying when the request is rate limited
+func DeleteMembershipWithRetry(limiter *RateLimiter, membershipID string) error {
+	for {
+		limiter.Wait()
+		response, err := SparkClient.Memberships.DeleteMembership(membershipID)
+		if verbose && response != nil {
+			PrintRequestWithoutBody(response.Request)
+		}
+		if IsRateLimited(response) {
+			time.Sleep(RetryAfter(response, 10*time.Second))
+			continue
+		}
+		return err
+	}
+}
+
+// UpdateMembershipWithRetry updates a membership through the rate limiter, retrying when the request is rate limited
+func UpdateMembershipWithRetry(limiter *RateLimiter, membershipID string, updateRequest *ciscospark.UpdateMembershipRequest) (*ciscospark.Membership, error) {
+	for {
+		limiter.Wait()
+		membership, response, err := SparkClient.Memberships.UpdateMembership(membershipID, updateRequest)
+		if verbose && response != nil {
+			PrintRequestWithBody(response.Request, updateRequest)
+		}
+		if IsRateLimited(response) {
+			time.Sleep(RetryAfter(response, 10*time.Second))
+			continue
+		}
+		return membership, err
+	}
+}
+
+// PostTeamMembershipWithRetry adds a team membership through the rate limiter, retrying when the request is rate limited
+func PostTeamMembershipWithRetry(limiter *RateLimiter, membershipRequest *ciscospark.TeamMembershipRequest) (*ciscospark.TeamMembership, error) {
+	for {
+		limiter.Wait()
+		membership, response, err := SparkClient.TeamMemberships.Post(membershipRequest)
+		if verbose && response != nil {
+			PrintRequestWithBody(response.Request, membershipRequest)
+		}
+		if IsRateLimited(response) {
+			time.Sleep(RetryAfter(response, 10*time.Second))
+			continue
+		}
+		return membership, err
+	}
+}
+
+// UpdateTeamMembershipWithRetry updates a team membership through the rate limiter, retrying when the request is rate limited
+func UpdateTeamMembershipWithRetry(limiter *RateLimiter, membershipID string, updateRequest *ciscospark.UpdateTeamMembershipRequest) (*ciscospark.TeamMembership, error) {
+	for {
+		limiter.Wait()
+		membership, response, err := SparkClient.TeamMemberships.UpdateTeamMembership(membershipID, updateRequest)
+		if verbose && response != nil {
+			PrintRequestWithBody(response.Request, updateRequest)
+		}
+		if IsRateLimited(response) {
+			time.Sleep(RetryAfter(response, 10*time.Second))
+			continue
+		}
+		return membership, err
+	}
+}
+
+// DeleteTeamMembershipWithRetry deletes a team membership through the rate limiter, retrying when the request is rate limited
+func DeleteTeamMembershipWithRetry(limiter *RateLimiter, membershipID string) error {
+	for {
+		limiter.Wait()
+		response, err := SparkClient.TeamMemberships.DeleteTeamMembership(membershipID)
+		if verbose && response != nil {
+			PrintRequestWithoutBody(response.Request)
+		}
+		if IsRateLimited(response) {
+			time.Sleep(RetryAfter(response, 10*time.Second))
+			continue
+		}
+		return err
+	}
+}
+
+// DeleteRoomWithRetry deletes a room through the rate limiter, retrying when the request is rate limited
+func DeleteRoomWithRetry(limiter *RateLimiter, roomID string) error {
+	for {
+		limiter.Wait()
+		response, err := SparkClient.Rooms.DeleteRoom(roomID)
+		if verbose && response != nil {
+			PrintRequestWithoutBody(response.Request)
+		}
+		if IsRateLimited(response) {
+			time.Sleep(RetryAfter(response, 10*time.Second))
+			continue
+		}
+		return err
+	}
+}
+
+// PostMembershipWithRetry adds a membership through the rate limiter, retrying when the request is rate limited
+func PostMembershipWithRetry(limiter *RateLimiter, membershipRequest *ciscospark.MembershipRequest) (*ciscospark.Membership, error) {
+	for {
+		limiter.Wait()
+		membership, response, err := SparkClient.Memberships.Post(membershipRequest)
+		if verbose && response != nil {
+			PrintRequestWithBody(response.Request, membershipRequest)
+		}
+		if IsRateLimited(response) {
+			time.Sleep(RetryAfter(response, 10*time.Second))
+			continue
+		}
+		return membership, err
+	}
+}
+
+// SparkIDUUID returns the UUID of a Spark ID, ciscospark:// URI or client link, or the ID itself when it cannot be decoded
+func SparkIDUUID(id string) string {
+	sparkID, err := ParseSparkID(id, "")
+	if err != nil {
+		return id
+	}
+	return sparkID.UUID
+}
+
+// PostSparkMessageFile posts a message with a file attachment, uploaded from memory
+func PostSparkMessageFile(messageRequest *SparkMessageRequest, fileName string, content io.Reader) (*SparkMessage, error) {
+	message, _, err := postSparkMessageFile(messageRequest, fileName, content)
+	return message, err
+}
+
+// PostSparkMessageFileWithRetry posts a message with a local file through the rate limiter,
+// retrying when the request is rate limited
+func PostSparkMessageFileWithRetry(limiter *RateLimiter, messageRequest *SparkMessageRequest, fileName, path string) (*SparkMessage, error) {
+	for {
+		content, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		limiter.Wait()
+		message, response, err := postSparkMessageFile(messageRequest, fileName, content)
+		content.Close()
+		if IsRateLimited(response) {
+			time.Sleep(RetryAfter(response, 10*time.Second))
+			continue
+		}
+		return message, err
+	}
+}
+
+// postSparkMessageFile posts a message with a file and returns the response
+func postSparkMessageFile(messageRequest *SparkMessageRequest, fileName string, content io.Reader) (*SparkMessage, *ciscospark.Response, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	fields := map[string]string{
+		"roomId":        messageRequest.RoomID,
+		"parentId":      messageRequest.ParentID,
+		"toPersonId":    messageRequest.ToPersonID,
+		"toPersonEmail": messageRequest.ToPersonEmail,
+		"text":          messageRequest.Text,
+		"markdown":      messageRequest.MarkDown,
+	}
+	for name, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := writer.WriteField(name, value); err != nil {
+			return nil, nil, err
+		}
+	}
+	part, err := writer.CreateFormFile("files", fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := io.Copy(part, content); err != nil {
+		return nil, nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	// the request is built by hand since NewRequest only sends JSON bodies
+	endpoint, err := SparkClient.BaseURL.Parse("messages")
+	if err != nil {
+		return nil, nil, err
+	}
+	request, err := http.NewRequest("POST", endpoint.String(), &body)
+	if err != nil {
+		return nil, nil, err
+	}
+	request.Header.Set("Authorization", SparkClient.Authorization)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+
+	message := new(SparkMessage)
+	response, err := SparkClient.Do(request, message)
+	if verbose && response != nil {
+		PrintRequestWithBody(response.Request, fields)
+	}
+	if err != nil {
+		return nil, response, err
+	}
+	return message, response, nil
+}
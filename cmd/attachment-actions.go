@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"log"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var attachmentActionID string
+
+// AttachmentAction is a submission of an Adaptive Card, with the inputs filled by the user
+type AttachmentAction struct {
+	ID        string                 `json:"id,omitempty"`
+	Type      string                 `json:"type,omitempty"`
+	MessageID string                 `json:"messageId,omitempty"`
+	Inputs    map[string]interface{} `json:"inputs,omitempty"`
+	PersonID  string                 `json:"personId,omitempty"`
+	RoomID    string                 `json:"roomId,omitempty"`
+	Created   *time.Time             `json:"created,omitempty"`
+}
+
+// GetAttachmentAction shows the details of an attachment action, by ID
+func GetAttachmentAction(id string) (*AttachmentAction, error) {
+	request, err := SparkClient.NewRequest("GET", "attachment/actions/"+id, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	action := new(AttachmentAction)
+	response, err := SparkClient.Do(request, action)
+	if verbose && response != nil {
+		PrintRequestWithoutBody(response.Request)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return action, nil
+}
+
+// attachmentActionsCmd represents the attachment-actions command
+var attachmentActionsCmd = &cobra.Command{
+	Use:   "attachment-actions",
+	Short: "Attachment actions are the submissions of the Adaptive Cards sent in messages.",
+	Long: `Attachment actions are the submissions of the Adaptive Cards sent in messages. When a user submits a card, an attachment action is created with the inputs of the card.
+
+Use webhooks listen to receive the attachmentActions:created events with their inputs.`,
+}
+
+// attachmentActionsGetCmd represents the attachment-actions GET/<id> command
+var attachmentActionsGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get attachment action details",
+	Long: `Shows details for an attachment action, by ID, including the submitted inputs.
+
+Specify the attachment action ID with the -i/--id flag.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		action, err := GetAttachmentAction(attachmentActionID)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		PrintResponseFormat(action)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(attachmentActionsCmd)
+	attachmentActionsCmd.AddCommand(attachmentActionsGetCmd)
+
+	attachmentActionsGetCmd.Flags().StringVarP(&attachmentActionID, "id", "i", "", "The attachment action ID")
+
+	setIDFlagType(attachmentActionsGetCmd, "id", "ATTACHMENT_ACTION")
+}
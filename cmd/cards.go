@@ -0,0 +1,307 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// AdaptiveCardContentType is the attachment content type of Adaptive Cards
+const AdaptiveCardContentType = "application/vnd.microsoft.card.adaptive"
+
+// maxCardSize is the maximum size, in bytes, of an Adaptive Card accepted by Spark
+const maxCardSize = 28 * 1024
+
+// cardVarRegexp matches the ${name} card template variables
+var cardVarRegexp = regexp.MustCompile(`\$\{([A-Za-z0-9_.-]+)\}`)
+
+// cardSchemaElement describes an Adaptive Card element or action in the bundled schema
+type cardSchemaElement struct {
+	Since    string
+	Required []string
+}
+
+// cardSchemaVersions are the Adaptive Card versions supported by Spark
+var cardSchemaVersions = []string{"1.0", "1.1", "1.2", "1.3"}
+
+// cardSchemaElements are the body elements supported by Spark, with the version that introduced them
+var cardSchemaElements = map[string]cardSchemaElement{
+	"TextBlock":               {Since: "1.0", Required: []string{"text"}},
+	"Image":                   {Since: "1.0", Required: []string{"url"}},
+	"ImageSet":                {Since: "1.0", Required: []string{"images"}},
+	"Container":               {Since: "1.0", Required: []string{"items"}},
+	"ColumnSet":               {Since: "1.0"},
+	"Column":                  {Since: "1.0"},
+	"FactSet":                 {Since: "1.0", Required: []string{"facts"}},
+	"Input.Text":              {Since: "1.0", Required: []string{"id"}},
+	"Input.Number":            {Since: "1.0", Required: []string{"id"}},
+	"Input.Date":              {Since: "1.0", Required: []string{"id"}},
+	"Input.Time":              {Since: "1.0", Required: []string{"id"}},
+	"Input.Toggle":            {Since: "1.0", Required: []string{"id", "title"}},
+	"Input.ChoiceSet":         {Since: "1.0", Required: []string{"id", "choices"}},
+	"ActionSet":               {Since: "1.2", Required: []string{"actions"}},
+	"RichTextBlock":           {Since: "1.2", Required: []string{"inlines"}},
+	"TextRun":                 {Since: "1.2", Required: []string{"text"}},
+	"Action.Submit":           {Since: "1.0"},
+	"Action.OpenUrl":          {Since: "1.0", Required: []string{"url"}},
+	"Action.ShowCard":         {Since: "1.0", Required: []string{"card"}},
+	"Action.ToggleVisibility": {Since: "1.2", Required: []string{"targetElements"}},
+}
+
+// cardChildren are the properties holding nested elements or actions
+var cardChildren = []string{"body", "items", "columns", "actions", "inlines", "images"}
+
+// LoadAdaptiveCard reads an Adaptive Card from a JSON or YAML file and replaces its ${name} variables
+func LoadAdaptiveCard(path string, vars map[string]string) (map[string]interface{}, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var card map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var yamlCard map[interface{}]interface{}
+		if err := yaml.Unmarshal(content, &yamlCard); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		converted, ok := convertYAML(yamlCard).(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: the card must be an object", path)
+		}
+		card = converted
+	default:
+		if err := json.Unmarshal(content, &card); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+
+	templated, err := templateCard(card, vars)
+	if err != nil {
+		return nil, err
+	}
+	return templated.(map[string]interface{}), nil
+}
+
+// ParseCardVars parses the key=value pairs given with --card-var
+func ParseCardVars(pairs []string) (map[string]string, error) {
+	vars := make(map[string]string)
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid card variable %q, expected key=value", pair)
+		}
+		vars[parts[0]] = parts[1]
+	}
+	return vars, nil
+}
+
+// convertYAML turns the maps decoded by yaml into maps that can be encoded as JSON
+func convertYAML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[fmt.Sprint(key)] = convertYAML(item)
+		}
+		return converted
+	case []interface{}:
+		for i, item := range v {
+			v[i] = convertYAML(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// templateCard replaces the ${name} variables in every string of the card
+func templateCard(value interface{}, vars map[string]string) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			templated, err := templateCard(item, vars)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = templated
+		}
+		return v, nil
+	case []interface{}:
+		for i, item := range v {
+			templated, err := templateCard(item, vars)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = templated
+		}
+		return v, nil
+	case string:
+		var missing string
+		templated := cardVarRegexp.ReplaceAllStringFunc(v, func(match string) string {
+			name := cardVarRegexp.FindStringSubmatch(match)[1]
+			if value, ok := vars[name]; ok {
+				return value
+			}
+			missing = name
+			return match
+		})
+		if missing != "" {
+			return nil, fmt.Errorf("card variable %q is not defined, use --card-var %s=value", missing, missing)
+		}
+		return templated, nil
+	default:
+		return v, nil
+	}
+}
+
+// ValidateAdaptiveCard checks the card against the bundled Adaptive Cards schema
+func ValidateAdaptiveCard(card map[string]interface{}) error {
+	content, err := json.Marshal(card)
+	if err != nil {
+		return err
+	}
+	if len(content) > maxCardSize {
+		return fmt.Errorf("the card is %d bytes, the maximum is %d bytes", len(content), maxCardSize)
+	}
+
+	if card["type"] != "AdaptiveCard" {
+		return fmt.Errorf("the card type must be AdaptiveCard, got %v", card["type"])
+	}
+
+	var version string
+	switch v := card["version"].(type) {
+	case string:
+		version = v
+	case float64, int:
+		// an unquoted YAML version such as 1.2 is decoded as a number, it is sent as a string
+		version = fmt.Sprint(v)
+		if !strings.Contains(version, ".") {
+			version += ".0"
+		}
+		card["version"] = version
+	case nil:
+	default:
+		return fmt.Errorf("the card version must be a string such as \"1.3\", got %v", v)
+	}
+	if version == "" {
+		return fmt.Errorf("the card version is required, supported versions are %s", strings.Join(cardSchemaVersions, ", "))
+	}
+	supported := false
+	for _, v := range cardSchemaVersions {
+		if v == version {
+			supported = true
+		}
+	}
+	if !supported {
+		return fmt.Errorf("card version %s is not supported, supported versions are %s", version, strings.Join(cardSchemaVersions, ", "))
+	}
+
+	ids := make(map[string]bool)
+	for _, property := range []string{"body", "actions"} {
+		if err := validateCardElements(card[property], property, version, ids); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateCardElements checks a list of card elements and their children
+func validateCardElements(value interface{}, path, version string, ids map[string]bool) error {
+	if value == nil {
+		return nil
+	}
+	elements, ok := value.([]interface{})
+	if !ok {
+		return fmt.Errorf("%s: must be a list", path)
+	}
+
+	for i, item := range elements {
+		elementPath := fmt.Sprintf("%s[%d]", path, i)
+		if _, ok := item.(string); ok && strings.HasSuffix(path, ".inlines") {
+			// rich text blocks accept plain strings as text runs
+			continue
+		}
+		element, ok := item.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: must be an object", elementPath)
+		}
+
+		elementType, _ := element["type"].(string)
+		if elementType == "" {
+			// columns and images may omit their type
+			if strings.HasSuffix(path, ".columns") {
+				elementType = "Column"
+			} else if strings.HasSuffix(path, ".images") {
+				elementType = "Image"
+			} else {
+				return fmt.Errorf("%s: type is required", elementPath)
+			}
+		}
+		schema, ok := cardSchemaElements[elementType]
+		if !ok {
+			return fmt.Errorf("%s: unknown element type %s", elementPath, elementType)
+		}
+		if compareCardVersions(schema.Since, version) > 0 {
+			return fmt.Errorf("%s: %s requires card version %s or later", elementPath, elementType, schema.Since)
+		}
+		for _, property := range schema.Required {
+			if _, ok := element[property]; !ok {
+				return fmt.Errorf("%s: %s requires the %s property", elementPath, elementType, property)
+			}
+		}
+
+		if id, ok := element["id"].(string); ok {
+			if ids[id] {
+				return fmt.Errorf("%s: duplicated id %s", elementPath, id)
+			}
+			ids[id] = true
+		}
+
+		if elementType == "Action.ShowCard" {
+			showCard, ok := element["card"].(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s.card: must be an object", elementPath)
+			}
+			for _, property := range []string{"body", "actions"} {
+				if err := validateCardElements(showCard[property], elementPath+".card."+property, version, ids); err != nil {
+					return err
+				}
+			}
+		}
+		for _, property := range cardChildren {
+			if err := validateCardElements(element[property], elementPath+"."+property, version, ids); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compareCardVersions compares two major.minor card versions
+func compareCardVersions(a, b string) int {
+	pa := strings.SplitN(a, ".", 2)
+	pb := strings.SplitN(b, ".", 2)
+	for i := 0; i < 2; i++ {
+		var va, vb int
+		if i < len(pa) {
+			va, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			vb, _ = strconv.Atoi(pb[i])
+		}
+		if va != vb {
+			if va < vb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import "testing"
+
+func TestValidateAdaptiveCard(t *testing.T) {
+	textBlock := map[string]interface{}{"type": "TextBlock", "text": "hello"}
+
+	tests := []struct {
+		name    string
+		card    map[string]interface{}
+		version string
+		invalid bool
+	}{
+		{
+			name:    "string version",
+			card:    map[string]interface{}{"type": "AdaptiveCard", "version": "1.2", "body": []interface{}{textBlock}},
+			version: "1.2",
+		},
+		{
+			name:    "numeric YAML version",
+			card:    map[string]interface{}{"type": "AdaptiveCard", "version": 1.3, "body": []interface{}{textBlock}},
+			version: "1.3",
+		},
+		{
+			name:    "integer YAML version",
+			card:    map[string]interface{}{"type": "AdaptiveCard", "version": 1, "body": []interface{}{textBlock}},
+			version: "1.0",
+		},
+		{
+			name:    "missing version",
+			card:    map[string]interface{}{"type": "AdaptiveCard", "body": []interface{}{textBlock}},
+			invalid: true,
+		},
+		{
+			name:    "unsupported version",
+			card:    map[string]interface{}{"type": "AdaptiveCard", "version": "1.5"},
+			invalid: true,
+		},
+		{
+			name:    "wrong type",
+			card:    map[string]interface{}{"type": "MessageCard", "version": "1.2"},
+			invalid: true,
+		},
+		{
+			name:    "element newer than the version",
+			card:    map[string]interface{}{"type": "AdaptiveCard", "version": "1.1", "body": []interface{}{map[string]interface{}{"type": "ActionSet", "actions": []interface{}{}}}},
+			invalid: true,
+		},
+		{
+			name:    "missing required property",
+			card:    map[string]interface{}{"type": "AdaptiveCard", "version": "1.2", "body": []interface{}{map[string]interface{}{"type": "TextBlock"}}},
+			invalid: true,
+		},
+		{
+			name: "duplicated id",
+			card: map[string]interface{}{"type": "AdaptiveCard", "version": "1.2", "body": []interface{}{
+				map[string]interface{}{"type": "Input.Text", "id": "name"},
+				map[string]interface{}{"type": "Input.Text", "id": "name"},
+			}},
+			invalid: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateAdaptiveCard(test.card)
+			if test.invalid {
+				if err == nil {
+					t.Fatal("ValidateAdaptiveCard succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateAdaptiveCard: %v", err)
+			}
+			if version := test.card["version"]; version != test.version {
+				t.Errorf("the card version is %v, want %s", version, test.version)
+			}
+		})
+	}
+}
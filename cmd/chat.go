@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ANSI escape sequences used by the chat format
+const (
+	ansiReset     = "\x1b[0m"
+	ansiBold      = "\x1b[1m"
+	ansiDim       = "\x1b[2m"
+	ansiItalic    = "\x1b[3m"
+	ansiUnderline = "\x1b[4m"
+	ansiYellow    = "\x1b[33m"
+	ansiBlue      = "\x1b[34m"
+	ansiMagenta   = "\x1b[35m"
+	ansiCyan      = "\x1b[36m"
+)
+
+// chatThreadIndent is the prefix of the replies in the chat format
+const chatThreadIndent = "    │ "
+
+var (
+	chatMentionRegexp    = regexp.MustCompile(`<@(?:personEmail|personId|groupMention):[^|>]*\|([^>]*)>|<@all>`)
+	chatLinkRegexp       = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	chatBoldRegexp       = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	chatItalicRegexp     = regexp.MustCompile(`(^|[^*\w])[*_]([^*_\s][^*_]*)[*_]`)
+	chatCodeRegexp       = regexp.MustCompile("`([^`]+)`")
+	chatHeaderRegexp     = regexp.MustCompile(`^#{1,6}\s+(.*)$`)
+	chatListRegexp       = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	chatHTMLMention      = regexp.MustCompile(`(?s)<spark-mention[^>]*>(.*?)</spark-mention>`)
+	chatHTMLLink         = regexp.MustCompile(`(?s)<a [^>]*href="([^"]*)"[^>]*>(.*?)</a>`)
+	chatHTMLTag          = regexp.MustCompile(`<[^>]+>`)
+	chatHTMLReplacements = strings.NewReplacer(
+		"<br>", "\n", "<br/>", "\n", "<br />", "\n", "</p>", "\n", "</li>", "\n", "<li>", "- ",
+		"<strong>", "**", "</strong>", "**", "<b>", "**", "</b>", "**",
+		"<em>", "*", "</em>", "*", "<i>", "*", "</i>", "*",
+		"<code>", "`", "</code>", "`", "<pre>", "```\n", "</pre>", "\n```",
+	)
+)
+
+// useColors returns whether stdout is a terminal and colors are not disabled with NO_COLOR
+func useColors() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// chatStyle wraps the text in an ANSI style when colors are enabled
+func chatStyle(colors bool, style, text string) string {
+	if !colors {
+		return text
+	}
+	return style + text + ansiReset
+}
+
+// htmlToMarkdown converts the html of a message to the markdown understood by the chat renderer
+func htmlToMarkdown(content string) string {
+	// the mentions are marked with control characters so the tags can be stripped
+	content = chatHTMLMention.ReplaceAllString(content, "\x01$1\x02")
+	content = chatHTMLLink.ReplaceAllString(content, "[$2]($1)")
+	content = chatHTMLReplacements.Replace(content)
+	content = chatHTMLTag.ReplaceAllString(content, "")
+	content = strings.NewReplacer("\x01", "<@personId:|", "\x02", ">").Replace(content)
+	return strings.TrimSpace(html.UnescapeString(content))
+}
+
+// renderMarkdownLine renders the inline markdown of a line with ANSI styles
+func renderMarkdownLine(line string, colors bool) string {
+	if match := chatHeaderRegexp.FindStringSubmatch(line); match != nil {
+		return chatStyle(colors, ansiBold+ansiUnderline, match[1])
+	}
+	if match := chatListRegexp.FindStringSubmatch(line); match != nil {
+		line = match[1] + "• " + match[2]
+	}
+
+	// inline code is rendered first and protected from the other styles
+	var codes []string
+	line = chatCodeRegexp.ReplaceAllStringFunc(line, func(code string) string {
+		codes = append(codes, chatStyle(colors, ansiYellow, code[1:len(code)-1]))
+		return fmt.Sprintf("\x00%d\x00", len(codes)-1)
+	})
+
+	line = chatMentionRegexp.ReplaceAllStringFunc(line, func(mention string) string {
+		name := "all"
+		if match := chatMentionRegexp.FindStringSubmatch(mention); match[1] != "" {
+			name = match[1]
+		}
+		return chatStyle(colors, ansiBold+ansiMagenta, "@"+name)
+	})
+	line = chatLinkRegexp.ReplaceAllStringFunc(line, func(link string) string {
+		match := chatLinkRegexp.FindStringSubmatch(link)
+		if match[1] == match[2] {
+			return chatStyle(colors, ansiUnderline+ansiBlue, match[2])
+		}
+		return match[1] + " (" + chatStyle(colors, ansiUnderline+ansiBlue, match[2]) + ")"
+	})
+	line = chatBoldRegexp.ReplaceAllStringFunc(line, func(bold string) string {
+		return chatStyle(colors, ansiBold, bold[2:len(bold)-2])
+	})
+	line = chatItalicRegexp.ReplaceAllString(line, "$1"+chatStyle(colors, ansiItalic, "$2"))
+
+	for i, code := range codes {
+		line = strings.Replace(line, fmt.Sprintf("\x00%d\x00", i), code, 1)
+	}
+	return line
+}
+
+// RenderMarkdown renders markdown to ANSI styled text: headers, bold, italic, inline code, code blocks, lists, links and mentions
+func RenderMarkdown(markdown string, colors bool) []string {
+	var lines []string
+	var marker string
+	for _, line := range strings.Split(markdown, "\n") {
+		if marker == "" && fenceMarker(line) != "" {
+			marker = fenceMarker(line)
+			continue
+		}
+		if marker != "" && closesFence(line, marker) {
+			marker = ""
+			continue
+		}
+		if marker != "" {
+			lines = append(lines, chatStyle(colors, ansiDim, "  "+line))
+			continue
+		}
+		lines = append(lines, renderMarkdownLine(line, colors))
+	}
+	return lines
+}
+
+// writeChatMessage writes a message and its replies in the chat format
+func writeChatMessage(w io.Writer, message *ExportedMessage, replies map[string][]*ExportedMessage, prefix string, colors bool) {
+	var created string
+	if message.Created != nil {
+		created = message.Created.Local().Format("2006-01-02 15:04")
+	}
+	fmt.Fprintf(w, "%s%s %s\n", prefix, chatStyle(colors, ansiBold+ansiCyan, message.PersonDisplayName), chatStyle(colors, ansiDim, created))
+
+	body := message.MarkDown
+	if body == "" && message.HTML != "" {
+		body = htmlToMarkdown(message.HTML)
+	}
+	if body == "" {
+		body = message.Text
+	}
+	for _, line := range RenderMarkdown(body, colors) {
+		fmt.Fprintf(w, "%s  %s\n", prefix, line)
+	}
+	for _, file := range message.Files {
+		fmt.Fprintf(w, "%s  %s %s\n", prefix, chatStyle(colors, ansiDim, "[file]"), file)
+	}
+	for _, attachment := range message.Attachments {
+		fmt.Fprintf(w, "%s  %s %s\n", prefix, chatStyle(colors, ansiDim, "[attachment]"), attachment.ContentType)
+	}
+	fmt.Fprintln(w, strings.TrimRight(prefix, " "))
+
+	for _, reply := range replies[message.ID] {
+		writeChatMessage(w, reply, replies, prefix+chatThreadIndent, colors)
+	}
+}
+
+// PrintChat prints the messages as a conversation, oldest first, with the replies indented under their parent
+func PrintChat(messages []*SparkMessage) {
+	var exported []*ExportedMessage
+	for i := len(messages) - 1; i >= 0; i-- {
+		exported = append(exported, &ExportedMessage{
+			SparkMessage:      messages[i],
+			PersonDisplayName: PersonDisplayName(messages[i].PersonID, messages[i].PersonEmail),
+		})
+	}
+	if len(messages) > 1 && messages[0].Created != nil && messages[len(messages)-1].Created != nil &&
+		messages[0].Created.Before(*messages[len(messages)-1].Created) {
+		// the messages were already oldest first
+		for i, j := 0, len(exported)-1; i < j; i, j = i+1, j-1 {
+			exported[i], exported[j] = exported[j], exported[i]
+		}
+	}
+
+	colors := useColors()
+	roots, replies := ThreadMessages(exported)
+	for _, message := range roots {
+		writeChatMessage(os.Stdout, message, replies, "", colors)
+	}
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// roomFilterClauseRegexp matches a clause of a room filter, such as title =~ "eng-"
+var roomFilterClauseRegexp = regexp.MustCompile(`^\s*(\w+)\s*(==|!=|=~|!~)\s*("(?:[^"\\]|\\.)*"|\S+)\s*$`)
+
+// roomFilterFields returns the value of the fields that can be used in room filters
+var roomFilterFields = map[string]func(room *SparkRoom) string{
+	"id":       func(room *SparkRoom) string { return room.ID },
+	"title":    func(room *SparkRoom) string { return room.Title },
+	"type":     func(room *SparkRoom) string { return room.Type },
+	"teamId":   func(room *SparkRoom) string { return room.TeamID },
+	"isLocked": func(room *SparkRoom) string { return strconv.FormatBool(room.IsLocked) },
+}
+
+// splitFilterClauses splits a room filter on the and keywords outside of the quoted values
+func splitFilterClauses(expression string) []string {
+	var clauses, words []string
+	var word strings.Builder
+	inQuote, escaped := false, false
+	endWord := func() {
+		if word.Len() > 0 {
+			words = append(words, word.String())
+			word.Reset()
+		}
+	}
+	for _, r := range expression {
+		switch {
+		case escaped:
+			escaped = false
+		case inQuote && r == '\\':
+			escaped = true
+		case r == '"':
+			inQuote = !inQuote
+		case !inQuote && (r == ' ' || r == '\t' || r == '\n'):
+			endWord()
+			continue
+		}
+		word.WriteRune(r)
+	}
+	endWord()
+
+	var clause []string
+	for _, w := range words {
+		if w == "and" {
+			clauses = append(clauses, strings.Join(clause, " "))
+			clause = nil
+			continue
+		}
+		clause = append(clause, w)
+	}
+	return append(clauses, strings.Join(clause, " "))
+}
+
+// RoomFilter is a predicate over rooms
+type RoomFilter func(room *SparkRoom) bool
+
+// ParseRoomFilter parses a room filter made of clauses joined by and, such as
+//
+//	title =~ "eng-" and type == group
+//
+// The fields are id, title, type, teamId and isLocked. The operators are == and != for equality,
+// =~ and !~ for regular expressions.
+func ParseRoomFilter(expression string) (RoomFilter, error) {
+	var clauses []RoomFilter
+	for _, clause := range splitFilterClauses(expression) {
+		match := roomFilterClauseRegexp.FindStringSubmatch(clause)
+		if match == nil {
+			return nil, fmt.Errorf("invalid filter clause %q, expected field op value", clause)
+		}
+
+		field, ok := roomFilterFields[match[1]]
+		if !ok {
+			return nil, fmt.Errorf("unknown filter field %s", match[1])
+		}
+		value := match[3]
+		if strings.HasPrefix(value, `"`) {
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid filter value %s", value)
+			}
+			value = unquoted
+		}
+
+		switch match[2] {
+		case "==":
+			clauses = append(clauses, func(room *SparkRoom) bool { return field(room) == value })
+		case "!=":
+			clauses = append(clauses, func(room *SparkRoom) bool { return field(room) != value })
+		case "=~", "!~":
+			expected := match[2] == "=~"
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return nil, err
+			}
+			clauses = append(clauses, func(room *SparkRoom) bool { return re.MatchString(field(room)) == expected })
+		}
+	}
+
+	return func(room *SparkRoom) bool {
+		for _, clause := range clauses {
+			if !clause(room) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// FilterSparkRooms returns the rooms matching the filter
+func FilterSparkRooms(rooms []*SparkRoom, filter RoomFilter) []*SparkRoom {
+	var filtered []*SparkRoom
+	for _, room := range rooms {
+		if filter(room) {
+			filtered = append(filtered, room)
+		}
+	}
+	return filtered
+}
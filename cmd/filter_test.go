@@ -0,0 +1,46 @@
+package cmd
+
+import "testing"
+
+func TestParseRoomFilter(t *testing.T) {
+	room := &SparkRoom{ID: "room-1", Title: "R and D weekly", Type: "group", TeamID: "team-1"}
+
+	tests := []struct {
+		name       string
+		expression string
+		match      bool
+		invalid    bool
+	}{
+		{name: "empty", expression: "", invalid: true},
+		{name: "equality", expression: "type == group", match: true},
+		{name: "inequality", expression: "type != group", match: false},
+		{name: "regular expression", expression: `title =~ "^R "`, match: true},
+		{name: "negated regular expression", expression: `title !~ "weekly"`, match: false},
+		{name: "clauses joined by and", expression: `type == group and teamId == team-1`, match: true},
+		{name: "one clause not matching", expression: `type == group and teamId == team-2`, match: false},
+		{name: "quoted and", expression: `title =~ "R and D"`, match: true},
+		{name: "quoted and with another clause", expression: `title == "R and D weekly" and type == group`, match: true},
+		{name: "escaped quote", expression: `title != "say \"hi\" and go"`, match: true},
+		{name: "unknown field", expression: "name == test", invalid: true},
+		{name: "missing value", expression: "title ==", invalid: true},
+		{name: "invalid regular expression", expression: `title =~ "("`, invalid: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter, err := ParseRoomFilter(test.expression)
+			if test.invalid {
+				if err == nil {
+					t.Fatalf("ParseRoomFilter(%q) succeeded, want an error", test.expression)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRoomFilter(%q): %v", test.expression, err)
+			}
+			if match := filter(room); match != test.match {
+				t.Errorf("ParseRoomFilter(%q) matched %v, want %v", test.expression, match, test.match)
+			}
+		})
+	}
+}
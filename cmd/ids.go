@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var idType, idCluster string
+
+// idTypeAnnotation is the flag annotation holding the type of the Spark IDs accepted by the flag
+const idTypeAnnotation = "go-spark-id-type"
+
+// sparkIDPrefix is the scheme of the URIs encoded in the Spark IDs
+const sparkIDPrefix = "ciscospark://"
+
+// uuidRegexp matches a raw UUID
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// sparkIDTypes are the types of the Spark IDs
+var sparkIDTypes = []string{
+	"ATTACHMENT_ACTION", "LICENSE", "MEMBERSHIP", "MESSAGE", "ORGANIZATION", "PEOPLE", "ROLE", "ROOM", "TEAM", "TEAM_MEMBERSHIP", "WEBHOOK",
+}
+
+// clientLinkTypes are the Spark ID types of the query parameters and path segments of the client links
+var clientLinkTypes = map[string]string{
+	"space": "ROOM", "spaces": "ROOM", "rooms": "ROOM", "team": "TEAM", "teams": "TEAM", "people": "PEOPLE",
+}
+
+// SparkID is a decoded Spark ID
+type SparkID struct {
+	ID      string `json:"id" csv:"id"`
+	Cluster string `json:"cluster" csv:"cluster"`
+	Type    string `json:"type" csv:"type"`
+	UUID    string `json:"uuid" csv:"uuid"`
+}
+
+// parseSparkURI parses a ciscospark://<cluster>/<type>/<uuid> URI
+func parseSparkURI(uri string) (*SparkID, error) {
+	parts := strings.Split(strings.TrimPrefix(uri, sparkIDPrefix), "/")
+	if !strings.HasPrefix(uri, sparkIDPrefix) || len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("%s is not a Spark ID", uri)
+	}
+	return &SparkID{ID: EncodeSparkID(parts[1], parts[2], parts[0]), Cluster: parts[0], Type: parts[1], UUID: parts[2]}, nil
+}
+
+// DecodeSparkID decodes a base64 Spark ID
+func DecodeSparkID(id string) (*SparkID, error) {
+	trimmed := strings.TrimRight(id, "=")
+	decoded, err := base64.RawStdEncoding.DecodeString(trimmed)
+	if err != nil {
+		decoded, err = base64.RawURLEncoding.DecodeString(trimmed)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a Spark ID", id)
+	}
+	sparkID, err := parseSparkURI(string(decoded))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a Spark ID", id)
+	}
+	sparkID.ID = id
+	return sparkID, nil
+}
+
+// EncodeSparkID returns the Spark ID of a UUID, the cluster is us when empty
+func EncodeSparkID(idType, uuid, cluster string) string {
+	if cluster == "" {
+		cluster = "us"
+	}
+	return base64.RawStdEncoding.EncodeToString([]byte(sparkIDPrefix + cluster + "/" + strings.ToUpper(idType) + "/" + uuid))
+}
+
+// parseClientLink returns the type and UUID of a web or desktop client link, such as webexteams://im?space=<uuid>
+func parseClientLink(link string) (string, string, bool) {
+	parsed, err := url.Parse(link)
+	if err != nil || parsed.Scheme == "" {
+		return "", "", false
+	}
+	for key, values := range parsed.Query() {
+		if linkType, ok := clientLinkTypes[key]; ok && len(values) > 0 && uuidRegexp.MatchString(values[0]) {
+			return linkType, values[0], true
+		}
+	}
+	segments := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	for i := 0; i+1 < len(segments); i++ {
+		if linkType, ok := clientLinkTypes[segments[i]]; ok && uuidRegexp.MatchString(segments[i+1]) {
+			return linkType, segments[i+1], true
+		}
+	}
+	return "", "", false
+}
+
+// ParseSparkID decodes a Spark ID, a ciscospark:// URI or a client link. A raw UUID is decoded as the default type.
+func ParseSparkID(value, defaultType string) (*SparkID, error) {
+	value = strings.TrimSpace(value)
+	switch {
+	case strings.HasPrefix(value, sparkIDPrefix):
+		return parseSparkURI(value)
+	case uuidRegexp.MatchString(value):
+		if defaultType == "" {
+			return nil, fmt.Errorf("the type of the UUID %s is unknown, use --type", value)
+		}
+		return &SparkID{ID: EncodeSparkID(defaultType, value, ""), Cluster: "us", Type: defaultType, UUID: value}, nil
+	}
+	if linkType, uuid, ok := parseClientLink(value); ok {
+		return &SparkID{ID: EncodeSparkID(linkType, uuid, ""), Cluster: "us", Type: linkType, UUID: uuid}, nil
+	}
+	return DecodeSparkID(value)
+}
+
+// NormalizeSparkID converts a raw UUID, a ciscospark:// URI or a client link into a Spark ID, and checks its type.
+// Values that are not IDs, such as names and email addresses, are returned unchanged to be resolved later.
+func NormalizeSparkID(value, idType string) (string, error) {
+	sparkID, err := ParseSparkID(value, idType)
+	if err != nil {
+		return value, nil
+	}
+	if sparkID.Type != idType {
+		return "", fmt.Errorf("%s is a %s ID, a %s ID is expected", value, sparkID.Type, idType)
+	}
+	return sparkID.ID, nil
+}
+
+// setIDFlagType declares the type of the Spark IDs accepted by a flag, checked before the command runs
+func setIDFlagType(cmd *cobra.Command, name, idType string) {
+	if err := cmd.Flags().SetAnnotation(name, idTypeAnnotation, []string{idType}); err != nil {
+		panic(err)
+	}
+}
+
+// normalizeIDFlags converts the IDs given to the flags of the command and checks their types
+func normalizeIDFlags(cmd *cobra.Command) {
+	cmd.Flags().Visit(func(flag *pflag.Flag) {
+		types := flag.Annotations[idTypeAnnotation]
+		if len(types) == 0 || flag.Value.String() == "" {
+			return
+		}
+		id, err := NormalizeSparkID(flag.Value.String(), types[0])
+		if err != nil {
+			log.Fatalf("--%s: %v", flag.Name, err)
+		}
+		flag.Value.Set(id)
+	})
+}
+
+// idCmd represents the id command
+var idCmd = &cobra.Command{
+	Use:   "id",
+	Short: "Decode and encode Spark IDs",
+	Long: `Spark IDs are base64 encoded ciscospark://<cluster>/<type>/<uuid> URIs.
+
+The ID flags of every command also accept a raw UUID, a ciscospark:// URI or a web or desktop client link,
+and fail when the ID is of another type, for example a person ID given to rooms get.`,
+}
+
+// idDecodeCmd represents the id decode command
+var idDecodeCmd = &cobra.Command{
+	Use:   "decode <id>...",
+	Short: "Decode Spark IDs",
+	Long:  `Shows the cluster, the type and the UUID of Spark IDs, ciscospark:// URIs or client links.`,
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var ids []*SparkID
+		for _, arg := range args {
+			sparkID, err := ParseSparkID(arg, "")
+			if err != nil {
+				log.Fatal(err)
+			}
+			ids = append(ids, sparkID)
+		}
+		if len(ids) == 1 {
+			PrintResponseFormat(ids[0])
+			return
+		}
+		PrintResponseFormat(ids)
+	},
+}
+
+// idEncodeCmd represents the id encode command
+var idEncodeCmd = &cobra.Command{
+	Use:   "encode <uuid>...",
+	Short: "Encode Spark IDs",
+	Long: `Shows the Spark IDs of UUIDs of the -t/--type type, or of ciscospark:// URIs or client links.
+
+Types: ` + strings.Join(sparkIDTypes, ", "),
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		upperType := strings.ToUpper(idType)
+		for _, arg := range args {
+			var id string
+			if uuidRegexp.MatchString(arg) {
+				if upperType == "" {
+					log.Fatalf("the type of the UUID %s is unknown, use --type", arg)
+				}
+				id = EncodeSparkID(upperType, arg, idCluster)
+			} else {
+				sparkID, err := ParseSparkID(arg, upperType)
+				if err != nil {
+					log.Fatal(err)
+				}
+				id = sparkID.ID
+			}
+			fmt.Println(id)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(idCmd)
+	idCmd.AddCommand(idDecodeCmd)
+	idCmd.AddCommand(idEncodeCmd)
+
+	idEncodeCmd.Flags().StringVarP(&idType, "type", "t", "", "The type of the UUIDs, for example ROOM or PEOPLE.")
+	idEncodeCmd.Flags().StringVar(&idCluster, "cluster", "us", "The cluster of the IDs.")
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import "testing"
+
+func TestParseSparkID(t *testing.T) {
+	uuid := "0b2d4e6a-1234-4c5d-8e9f-0123456789ab"
+	roomID := EncodeSparkID("ROOM", uuid, "")
+
+	tests := []struct {
+		name        string
+		value       string
+		defaultType string
+		id          string
+		idType      string
+		cluster     string
+		invalid     bool
+	}{
+		{name: "Spark ID", value: roomID, id: roomID, idType: "ROOM", cluster: "us"},
+		{name: "Spark ID with padding", value: roomID + "=", id: roomID + "=", idType: "ROOM", cluster: "us"},
+		{name: "URI", value: "ciscospark://eu/TEAM/" + uuid, id: EncodeSparkID("TEAM", uuid, "eu"), idType: "TEAM", cluster: "eu"},
+		{name: "UUID with a default type", value: uuid, defaultType: "MESSAGE", id: EncodeSparkID("MESSAGE", uuid, ""), idType: "MESSAGE", cluster: "us"},
+		{name: "UUID without a default type", value: uuid, invalid: true},
+		{name: "client link query", value: "webexteams://im?space=" + uuid, id: roomID, idType: "ROOM", cluster: "us"},
+		{name: "client link path", value: "https://teams.webex.com/spaces/" + uuid + "/chat", id: roomID, idType: "ROOM", cluster: "us"},
+		{name: "name", value: "Engineering", invalid: true},
+		{name: "incomplete URI", value: "ciscospark://us/ROOM", invalid: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sparkID, err := ParseSparkID(test.value, test.defaultType)
+			if test.invalid {
+				if err == nil {
+					t.Fatalf("ParseSparkID(%q) = %+v, want an error", test.value, sparkID)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSparkID(%q): %v", test.value, err)
+			}
+			if sparkID.ID != test.id || sparkID.Type != test.idType || sparkID.Cluster != test.cluster || sparkID.UUID != uuid {
+				t.Errorf("ParseSparkID(%q) = %+v, want ID %s, type %s, cluster %s and UUID %s", test.value, sparkID, test.id, test.idType, test.cluster, uuid)
+			}
+		})
+	}
+}
+
+func TestEncodeSparkID(t *testing.T) {
+	tests := []struct {
+		idType  string
+		uuid    string
+		cluster string
+		id      string
+	}{
+		{"ROOM", "abc", "", "Y2lzY29zcGFyazovL3VzL1JPT00vYWJj"},
+		{"room", "abc", "us", "Y2lzY29zcGFyazovL3VzL1JPT00vYWJj"},
+		{"PEOPLE", "abc", "eu", "Y2lzY29zcGFyazovL2V1L1BFT1BMRS9hYmM"},
+	}
+
+	for _, test := range tests {
+		if id := EncodeSparkID(test.idType, test.uuid, test.cluster); id != test.id {
+			t.Errorf("EncodeSparkID(%q, %q, %q) = %s, want %s", test.idType, test.uuid, test.cluster, id, test.id)
+		}
+	}
+}
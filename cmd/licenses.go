@@ -67,4 +67,5 @@ func init() {
 	licensesGetCmd.Flags().StringVarP(&licenseID, "id", "i", "", "The license ID")
 	licensesListCmd.Flags().StringVarP(&licenseOrgID, "orgId", "o", "", "Specify the organization")
 
+	setIDFlagType(licensesGetCmd, "id", "LICENSE")
 }
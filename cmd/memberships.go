@@ -28,7 +28,12 @@ Use query parameters to filter the response.
 
 Use -r/--room to list memberships for a room, by ID.
 
-Use either -p/--person-id or -e/--person-email to filter the results.`,
+Use either -p/--person-id or -e/--person-email to filter the results. -p/--person-id also accepts an email address,
+a display name or me.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		resolveRoomFlags("room")(cmd, args)
+		resolvePersonFlags("person-id")(cmd, args)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		membershipQueryParams := &ciscospark.MembershipQueryParams{
 			Max: Max,
@@ -67,11 +72,15 @@ var membershipsCreateCmd = &cobra.Command{
 
 Use -r/-room to define the room
 
-Use -p/--person-id to define the person id.
+Use -p/--person-id to define the person, by ID, email address, display name or me.
 
 Use -e/--person-email to define the person email.
 
 Use -M/--moderator to define the person as moderator`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		resolveRoomFlags("room")(cmd, args)
+		resolvePersonFlags("person-id")(cmd, args)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		membershipRequest := &ciscospark.MembershipRequest{
 			RoomID: membershipRoomID,
@@ -180,12 +189,12 @@ func init() {
 	membershipsCmd.AddCommand(membershipsUpdateCmd)
 	membershipsCmd.AddCommand(membershipsDeleteCmd)
 
-	membershipsListCmd.Flags().StringVarP(&membershipRoomID, "room", "r", "", "Limit results to a specific room, by ID.")
-	membershipsListCmd.Flags().StringVarP(&membershipPersonID, "person-id", "p", "", "Limit results to a specific person, by ID.")
+	membershipsListCmd.Flags().StringVarP(&membershipRoomID, "room", "r", "", "Limit results to a specific room, by ID or name.")
+	membershipsListCmd.Flags().StringVarP(&membershipPersonID, "person-id", "p", "", "Limit results to a specific person, by ID, email address, display name or me.")
 	membershipsListCmd.Flags().StringVarP(&membershipPersonEmail, "person-email", "e", "", "Limit results to a specific person, by email address.")
 
-	membershipsCreateCmd.Flags().StringVarP(&membershipRoomID, "room", "r", "", "The room ID.")
-	membershipsCreateCmd.Flags().StringVarP(&membershipPersonID, "person-id", "p", "", "The person ID.")
+	membershipsCreateCmd.Flags().StringVarP(&membershipRoomID, "room", "r", "", "The room, by ID or name.")
+	membershipsCreateCmd.Flags().StringVarP(&membershipPersonID, "person-id", "p", "", "The person, by ID, email address, display name or me.")
 	membershipsCreateCmd.Flags().StringVarP(&membershipPersonEmail, "person-email", "e", "", "The email address of the person.")
 	membershipsCreateCmd.Flags().BoolVarP(&membershipModerator, "moderator", "M", false, "Set to true to make the person a room moderator")
 
@@ -196,4 +205,11 @@ func init() {
 
 	membershipsDeleteCmd.Flags().StringVarP(&membershipID, "id", "i", "", "The membership ID.")
 
+	setIDFlagType(membershipsListCmd, "room", "ROOM")
+	setIDFlagType(membershipsListCmd, "person-id", "PEOPLE")
+	setIDFlagType(membershipsCreateCmd, "room", "ROOM")
+	setIDFlagType(membershipsCreateCmd, "person-id", "PEOPLE")
+	setIDFlagType(membershipsGetCmd, "id", "MEMBERSHIP")
+	setIDFlagType(membershipsUpdateCmd, "id", "MEMBERSHIP")
+	setIDFlagType(membershipsDeleteCmd, "id", "MEMBERSHIP")
 }
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jbogarin/go-cisco-spark/ciscospark"
+)
+
+// inlineMentionRegexp matches the @{alice@example.com} and @{all} inline mention syntax
+var inlineMentionRegexp = regexp.MustCompile(`@\{([^}]+)\}`)
+
+// mentionAll is the keyword used to mention everybody in a room
+const mentionAll = "all"
+
+// findPersonByEmail looks up a person by email address
+func findPersonByEmail(email string) (*ciscospark.Person, error) {
+	queryParams := &ciscospark.GetPeopleQueryParams{
+		Email: email,
+		Max:   1,
+	}
+
+	people, response, err := SparkClient.People.Get(queryParams)
+	if verbose && response != nil {
+		PrintRequestWithoutBody(response.Request)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(people) == 0 {
+		return nil, fmt.Errorf("person not found: %s", email)
+	}
+	return people[0], nil
+}
+
+// mentionMarkdown returns the markdown mention for a person email or for everybody (all)
+func mentionMarkdown(target string, cache map[string]string) (string, error) {
+	target = strings.TrimSpace(target)
+	if strings.EqualFold(target, mentionAll) {
+		return "<@all>", nil
+	}
+	if mention, ok := cache[target]; ok {
+		return mention, nil
+	}
+
+	person, err := findPersonByEmail(target)
+	if err != nil {
+		return "", err
+	}
+
+	name := person.DisplayName
+	if name == "" {
+		name = target
+	}
+	mention := fmt.Sprintf("<@personEmail:%s|%s>", target, name)
+	cache[target] = mention
+	return mention, nil
+}
+
+// expandMentions replaces the inline @{email} mentions of a message and prepends the mentions given with --mention.
+// It returns the expanded message and whether any mention was generated
+func expandMentions(message string, mentions []string) (string, bool, error) {
+	cache := make(map[string]string)
+	var expandErr error
+
+	expanded := inlineMentionRegexp.ReplaceAllStringFunc(message, func(match string) string {
+		if expandErr != nil {
+			return match
+		}
+		target := inlineMentionRegexp.FindStringSubmatch(match)[1]
+		mention, err := mentionMarkdown(target, cache)
+		if err != nil {
+			expandErr = err
+			return match
+		}
+		return mention
+	})
+	if expandErr != nil {
+		return "", false, expandErr
+	}
+	found := expanded != message
+
+	var prefix []string
+	for _, target := range mentions {
+		mention, err := mentionMarkdown(target, cache)
+		if err != nil {
+			return "", false, err
+		}
+		prefix = append(prefix, mention)
+	}
+	if len(prefix) > 0 {
+		found = true
+		expanded = strings.TrimSpace(strings.Join(prefix, " ") + " " + expanded)
+	}
+
+	return expanded, found, nil
+}
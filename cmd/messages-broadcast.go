@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/jbogarin/go-cisco-spark/ciscospark"
+	"github.com/spf13/cobra"
+)
+
+var broadcastRoomsFile, broadcastTeamID, broadcastFilter, broadcastMarkdown, broadcastText string
+var broadcastState, broadcastReport string
+var broadcastWorkers int
+var broadcastRate float64
+var broadcastYes, broadcastIncludeDirect bool
+
+// BroadcastResult is the outcome of a broadcast to a room
+type BroadcastResult struct {
+	RoomID    string `json:"roomId" csv:"roomId"`
+	RoomTitle string `json:"roomTitle" csv:"roomTitle"`
+	MessageID string `json:"messageId,omitempty" csv:"messageId"`
+	BulkStatus
+}
+
+// broadcastStateEntry records a message already broadcast to a room, to resume an interrupted broadcast
+type broadcastStateEntry struct {
+	RoomID    string `json:"roomId"`
+	Hash      string `json:"hash"`
+	MessageID string `json:"messageId"`
+}
+
+// readRoomsFile reads the room IDs of a file, one per line, ignoring empty lines and # comments
+func readRoomsFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var ids []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ids = append(ids, strings.Fields(line)[0])
+	}
+	return ids, scanner.Err()
+}
+
+// broadcastRooms returns the rooms selected with --rooms-file, --team and --filter
+func broadcastRooms() ([]*SparkRoom, error) {
+	if broadcastRoomsFile != "" && broadcastTeamID != "" {
+		return nil, fmt.Errorf("use either --rooms-file or --team")
+	}
+	if broadcastRoomsFile == "" && broadcastTeamID == "" && broadcastFilter == "" {
+		return nil, fmt.Errorf("select the rooms with --rooms-file, --team or --filter")
+	}
+
+	var rooms []*SparkRoom
+	if broadcastRoomsFile != "" {
+		ids, err := readRoomsFile(broadcastRoomsFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			room, _, err := SparkClient.Rooms.GetRoom(id)
+			if err != nil {
+				return nil, fmt.Errorf("room %s: %v", id, err)
+			}
+			rooms = append(rooms, &SparkRoom{ID: room.ID, Title: room.Title, Type: room.Type, TeamID: room.TeamID})
+		}
+	} else {
+		var err error
+		if rooms, err = ListAllRooms(&ciscospark.RoomQueryParams{TeamID: broadcastTeamID}); err != nil {
+			return nil, err
+		}
+		if !broadcastIncludeDirect {
+			var groupRooms []*SparkRoom
+			for _, room := range rooms {
+				if room.Type != "direct" {
+					groupRooms = append(groupRooms, room)
+				}
+			}
+			rooms = groupRooms
+		}
+	}
+
+	if broadcastFilter != "" {
+		filter, err := ParseRoomFilter(broadcastFilter)
+		if err != nil {
+			return nil, err
+		}
+		rooms = FilterSparkRooms(rooms, filter)
+	}
+	return rooms, nil
+}
+
+// readBroadcastState reads the messages already broadcast, by room ID and message hash
+func readBroadcastState(path string) map[string]string {
+	sent := make(map[string]string)
+	file, err := os.Open(path)
+	if err != nil {
+		return sent
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry := new(broadcastStateEntry)
+		if err := json.Unmarshal(scanner.Bytes(), entry); err == nil {
+			sent[entry.RoomID+"/"+entry.Hash] = entry.MessageID
+		}
+	}
+	return sent
+}
+
+// renderRoomTemplate renders a message template for a room, the template can use .ID, .Title, .Type and .TeamID
+func renderRoomTemplate(tmpl *template.Template, room *SparkRoom) (string, error) {
+	if tmpl == nil {
+		return "", nil
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, room); err != nil {
+		return "", err
+	}
+	return rendered.String(), nil
+}
+
+// messagesBroadcastCmd represents the messages broadcast command
+var messagesBroadcastCmd = &cobra.Command{
+	Use:   "broadcast",
+	Short: "Post a message to many rooms",
+	Long: `Posts the same message to many rooms concurrently, reporting the result for every room.
+
+Select the rooms with --rooms-file (one room ID per line), or --team to use the rooms of a team,
+and/or --filter to keep only the matching rooms, for example 'title =~ "eng-" and type == group'.
+With --filter alone, every group room is matched. The 1:1 direct rooms are left out unless --include-direct is used.
+
+Use -M/--markdown or -T/--text to define the message. The message is a Go template rendered for every room,
+with .ID, .Title, .Type and .TeamID, for example "Hello {{.Title}}".
+
+The rooms are posted to by -w/--workers workers, sharing --rate requests per second.
+The sent messages are recorded in the --state file: running the same broadcast again skips the rooms already done.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if broadcastMarkdown == "" && broadcastText == "" {
+			fmt.Println(cmd.Help())
+			os.Exit(-1)
+		}
+
+		var markdownTemplate, textTemplate *template.Template
+		var err error
+		if broadcastMarkdown != "" {
+			if markdownTemplate, err = template.New("markdown").Parse(broadcastMarkdown); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if broadcastText != "" {
+			if textTemplate, err = template.New("text").Parse(broadcastText); err != nil {
+				log.Fatal(err)
+			}
+		}
+		hash := sha1.Sum([]byte(broadcastMarkdown + "\x00" + broadcastText))
+		messageHash := hex.EncodeToString(hash[:])
+
+		rooms, err := broadcastRooms()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(rooms) == 0 {
+			log.Fatal("no rooms selected")
+		}
+		if !broadcastYes && !Confirm(fmt.Sprintf("Post the message to %d rooms?", len(rooms))) {
+			fmt.Fprintln(os.Stderr, "Aborted")
+			os.Exit(-1)
+		}
+
+		sent := readBroadcastState(broadcastState)
+		stateFile, err := os.OpenFile(broadcastState, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer stateFile.Close()
+		var stateMutex sync.Mutex
+
+		limiter := NewRateLimiter(broadcastRate)
+		results := make([]*BroadcastResult, len(rooms))
+		failed := RunBulk(len(rooms), broadcastWorkers, func(index int) (string, *BulkStatus) {
+			room := rooms[index]
+			result := &BroadcastResult{RoomID: room.ID, RoomTitle: room.Title}
+			results[index] = result
+
+			if messageID, ok := sent[room.ID+"/"+messageHash]; ok {
+				result.MessageID = messageID
+				result.Status = "skipped"
+				return room.Title, &result.BulkStatus
+			}
+
+			messageRequest := &SparkMessageRequest{RoomID: room.ID}
+			var message *SparkMessage
+			markdown, err := renderRoomTemplate(markdownTemplate, room)
+			if err == nil {
+				messageRequest.MarkDown = markdown
+				messageRequest.Text, err = renderRoomTemplate(textTemplate, room)
+			}
+			if err == nil {
+				message, err = PostSparkMessageWithRetry(limiter, messageRequest)
+			}
+			if err != nil {
+				result.Fail(err)
+				return room.Title, &result.BulkStatus
+			}
+
+			result.MessageID = message.ID
+			result.Status = "sent"
+			entry, _ := json.Marshal(&broadcastStateEntry{RoomID: room.ID, Hash: messageHash, MessageID: message.ID})
+			stateMutex.Lock()
+			stateFile.Write(append(entry, '\n'))
+			stateMutex.Unlock()
+			return room.Title, &result.BulkStatus
+		})
+		FinishBulk(results, failed, broadcastReport)
+	},
+}
+
+func init() {
+	messagesCmd.AddCommand(messagesBroadcastCmd)
+
+	messagesBroadcastCmd.Flags().StringVar(&broadcastRoomsFile, "rooms-file", "", "File with the room IDs, one per line.")
+	messagesBroadcastCmd.Flags().StringVar(&broadcastTeamID, "team", "", "Post to the rooms of a team, by ID.")
+	messagesBroadcastCmd.Flags().StringVar(&broadcastFilter, "filter", "", "Only post to the rooms matching this filter, for example 'title =~ \"eng-\"'.")
+	messagesBroadcastCmd.Flags().BoolVar(&broadcastIncludeDirect, "include-direct", false, "Also post to the 1:1 direct rooms selected with --team or --filter.")
+	messagesBroadcastCmd.Flags().StringVarP(&broadcastMarkdown, "markdown", "M", "", "The message, in markdown format.")
+	messagesBroadcastCmd.Flags().StringVarP(&broadcastText, "text", "T", "", "The message, in plain text.")
+	messagesBroadcastCmd.Flags().IntVarP(&broadcastWorkers, "workers", "w", 4, "The number of rooms posted to concurrently.")
+	messagesBroadcastCmd.Flags().Float64Var(&broadcastRate, "rate", 5, "The maximum number of requests per second.")
+	messagesBroadcastCmd.Flags().StringVar(&broadcastState, "state", "broadcast.state", "File recording the rooms already posted to, to resume an interrupted broadcast.")
+	messagesBroadcastCmd.Flags().StringVar(&broadcastReport, "report", "", "Write the results to this CSV file.")
+	messagesBroadcastCmd.Flags().BoolVarP(&broadcastYes, "yes", "y", false, "Do not ask for confirmation.")
+
+	setIDFlagType(messagesBroadcastCmd, "team", "TEAM")
+}
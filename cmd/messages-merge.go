@@ -0,0 +1,282 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gocarina/gocsv"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var mergeTemplate, mergeData, mergeResults string
+var mergeDryRun bool
+var mergeRate float64
+
+// MergeResult is the outcome of a mail merge row
+type MergeResult struct {
+	Row       int    `json:"row" csv:"row"`
+	Recipient string `json:"recipient" csv:"recipient"`
+	Hash      string `json:"hash" csv:"hash"`
+	MessageID string `json:"messageId,omitempty" csv:"messageId"`
+	Status    string `json:"status" csv:"status"`
+	Error     string `json:"error,omitempty" csv:"error"`
+}
+
+// readMergeData reads the rows of a CSV file with a header, or of a YAML list of objects
+func readMergeData(path string) ([]map[string]interface{}, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var yamlRows []interface{}
+		if err := yaml.Unmarshal(content, &yamlRows); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		for i, yamlRow := range yamlRows {
+			row, ok := convertYAML(yamlRow).(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: row %d must be an object", path, i+1)
+			}
+			rows = append(rows, row)
+		}
+	default:
+		records, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if len(records) == 0 {
+			return nil, nil
+		}
+		header := records[0]
+		for _, record := range records[1:] {
+			row := make(map[string]interface{})
+			for i, column := range header {
+				if i < len(record) {
+					row[strings.TrimSpace(column)] = record[i]
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// mergeRecipient returns the message request of a row: to its email column, or to its room column, or to the -r/--roomID room
+func mergeRecipient(row map[string]interface{}) (*SparkMessageRequest, string, error) {
+	value := func(keys ...string) string {
+		for _, key := range keys {
+			if v, ok := row[key]; ok && fmt.Sprint(v) != "" {
+				return strings.TrimSpace(fmt.Sprint(v))
+			}
+		}
+		return ""
+	}
+
+	if email := value("email", "Email"); email != "" {
+		return &SparkMessageRequest{ToPersonEmail: email}, email, nil
+	}
+	if room := value("room", "roomId", "Room"); room != "" {
+		return &SparkMessageRequest{RoomID: room}, room, nil
+	}
+	if roomID != "" {
+		return &SparkMessageRequest{RoomID: roomID}, roomID, nil
+	}
+	return nil, "", fmt.Errorf("the row has no email or room column and no -r/--roomID was given")
+}
+
+// readMergeResults reads the results of a previous run, it returns an empty list when there are none
+func readMergeResults(path string) []*MergeResult {
+	var results []*MergeResult
+	file, err := os.Open(path)
+	if err != nil {
+		return results
+	}
+	defer file.Close()
+	if err := gocsv.UnmarshalFile(file, &results); err != nil {
+		return []*MergeResult{}
+	}
+	return results
+}
+
+// postMergeMessage posts the message of a row through the rate limiter, handling the messages over the size limit
+// as defined by --overflow, and returns the ID of the first message posted
+func postMergeMessage(limiter *RateLimiter, messageRequest *SparkMessageRequest) (string, error) {
+	body := messageRequest.MarkDown
+	if len(body) <= MaxMessageSize {
+		message, err := PostSparkMessageWithRetry(limiter, messageRequest)
+		if err != nil {
+			return "", err
+		}
+		return message.ID, nil
+	}
+
+	switch messagesOverflow {
+	case "error":
+		return "", fmt.Errorf("the message is %d bytes, the maximum is %d bytes", len(body), MaxMessageSize)
+	case "file":
+		fileRequest := &SparkMessageRequest{
+			RoomID:        messageRequest.RoomID,
+			ToPersonEmail: messageRequest.ToPersonEmail,
+			Text:          "The message is too long, it is attached as message.md",
+		}
+		for {
+			limiter.Wait()
+			message, response, err := postSparkMessageFile(fileRequest, "message.md", strings.NewReader(body))
+			if IsRateLimited(response) {
+				time.Sleep(RetryAfter(response, 10*time.Second))
+				continue
+			}
+			if err != nil {
+				return "", err
+			}
+			return message.ID, nil
+		}
+	case "split":
+		var firstID string
+		for _, part := range SplitMessage(body, MaxMessageSize) {
+			partRequest := &SparkMessageRequest{RoomID: messageRequest.RoomID, ToPersonEmail: messageRequest.ToPersonEmail, MarkDown: part}
+			message, err := PostSparkMessageWithRetry(limiter, partRequest)
+			if err != nil {
+				return firstID, err
+			}
+			if firstID == "" {
+				firstID = message.ID
+			}
+		}
+		return firstID, nil
+	}
+	return "", fmt.Errorf("unsupported overflow %s, use split, file or error", messagesOverflow)
+}
+
+// runMailMerge renders the template for every row of the data file and sends the messages
+func runMailMerge() error {
+	content, err := ioutil.ReadFile(mergeTemplate)
+	if err != nil {
+		return err
+	}
+	tmpl, err := template.New(filepath.Base(mergeTemplate)).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return err
+	}
+
+	rows, err := readMergeData(mergeData)
+	if err != nil {
+		return err
+	}
+
+	resultsPath := mergeResults
+	if resultsPath == "" {
+		resultsPath = mergeData + ".results.csv"
+	}
+	// the rows already sent by a previous run, by recipient and message hash, are skipped
+	previous := readMergeResults(resultsPath)
+	sent := make(map[string]*MergeResult)
+	for _, result := range previous {
+		if result.Status == "sent" || result.Status == "skipped" {
+			sent[result.Recipient+"/"+result.Hash] = result
+		}
+	}
+
+	// save writes one result per row. Until the run is complete, the sent rows of the previous run
+	// not processed yet are kept so an interrupted run can be resumed without sending them again.
+	var results []*MergeResult
+	save := func(complete bool) error {
+		saved := append([]*MergeResult(nil), results...)
+		if !complete {
+			done := make(map[string]bool)
+			for _, result := range results {
+				done[result.Recipient+"/"+result.Hash] = true
+			}
+			for _, result := range previous {
+				key := result.Recipient + "/" + result.Hash
+				if sent[key] == result && !done[key] {
+					saved = append(saved, result)
+					done[key] = true
+				}
+			}
+		}
+		return WriteCSVFile(resultsPath, saved)
+	}
+
+	limiter := NewRateLimiter(mergeRate)
+	failed := 0
+	for i, row := range rows {
+		result := &MergeResult{Row: i + 1}
+		results = append(results, result)
+
+		var rendered bytes.Buffer
+		err := tmpl.Execute(&rendered, row)
+		messageRequest, recipient, recipientErr := mergeRecipient(row)
+		if err == nil {
+			err = recipientErr
+		}
+		result.Recipient = recipient
+		if err == nil {
+			var markdown string
+			markdown, _, err = expandMentions(rendered.String(), nil)
+			messageRequest.MarkDown = markdown
+			hash := sha1.Sum([]byte(markdown))
+			result.Hash = hex.EncodeToString(hash[:])
+		}
+		if err != nil {
+			result.Status = "failed"
+			result.Error = err.Error()
+			failed++
+			fmt.Fprintf(os.Stderr, "Row %d: %v\n", result.Row, err)
+			continue
+		}
+
+		if previousResult, ok := sent[result.Recipient+"/"+result.Hash]; ok {
+			result.Status = "skipped"
+			result.MessageID = previousResult.MessageID
+			continue
+		}
+		if mergeDryRun {
+			result.Status = "preview"
+			fmt.Printf("--- row %d to %s\n%s\n", result.Row, recipient, messageRequest.MarkDown)
+			continue
+		}
+
+		messageID, err := postMergeMessage(limiter, messageRequest)
+		if err != nil {
+			result.Status = "failed"
+			result.Error = err.Error()
+			failed++
+			fmt.Fprintf(os.Stderr, "Row %d: %v\n", result.Row, err)
+		} else {
+			result.Status = "sent"
+			result.MessageID = messageID
+			fmt.Fprintf(os.Stderr, "Row %d: sent to %s\n", result.Row, recipient)
+		}
+
+		// the results are saved after every message so an interrupted run can be resumed
+		if err := save(false); err != nil {
+			return err
+		}
+	}
+
+	if mergeDryRun {
+		return nil
+	}
+	if err := save(true); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%d rows, %d failed, results in %s\n", len(rows), failed, resultsPath)
+	if failed > 0 {
+		return fmt.Errorf("%d rows failed", failed)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var pipeRoomID string
+var pipeInterval time.Duration
+var pipeQuiet bool
+
+// postPipeBatch posts a batch of output lines as code fenced messages, split when over the size limit
+func postPipeBatch(lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	body := "```\n" + strings.Join(lines, "\n") + "\n```"
+	for _, part := range SplitMessage(body, MaxMessageSize) {
+		if _, err := PostSparkMessage(&SparkMessageRequest{RoomID: pipeRoomID, MarkDown: part}); err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to post the output:", err)
+		}
+	}
+}
+
+// pipeLines reads the lines of the readers into the channel, closing it when every reader is done
+func pipeLines(lines chan<- string, readers ...io.Reader) {
+	var wg sync.WaitGroup
+	for _, reader := range readers {
+		wg.Add(1)
+		go func(reader io.Reader) {
+			defer wg.Done()
+			scanner := bufio.NewScanner(reader)
+			scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+			for scanner.Scan() {
+				lines <- scanner.Text()
+			}
+			if err := scanner.Err(); err != nil {
+				// a line longer than the buffer stops the scanner, the rest is drained so the command does not block on a full pipe
+				fmt.Fprintf(os.Stderr, "Unable to read the output: %v\n", err)
+				lines <- fmt.Sprintf("[go-spark: unable to read the output: %v]", err)
+				io.Copy(ioutil.Discard, reader)
+			}
+		}(reader)
+	}
+	wg.Wait()
+	close(lines)
+}
+
+// messagesPipeCmd represents the messages pipe command
+var messagesPipeCmd = &cobra.Command{
+	Use:   "pipe [-- command [args...]]",
+	Short: "Post the output of a command to a room",
+	Long: `Runs a command and posts its output to a room, or posts the lines read from stdin when no command is given.
+
+The output lines are batched and posted as code blocks every -i/--interval. When the command finishes, a summary
+with its exit code and duration is posted and go-spark exits with the exit code of the command.
+
+Use -r/--room to define the room and -q/--quiet to not echo the output locally.
+
+Example: go-spark messages pipe --room <id> -- make test`,
+	PreRun: resolveRoomFlags("room"),
+	Run: func(cmd *cobra.Command, args []string) {
+		if pipeRoomID == "" {
+			fmt.Println(cmd.Help())
+			os.Exit(-1)
+		}
+
+		lines := make(chan string)
+		started := time.Now()
+		var command *exec.Cmd
+		if len(args) > 0 {
+			command = exec.Command(args[0], args[1:]...)
+			command.Stdin = os.Stdin
+			stdout, err := command.StdoutPipe()
+			if err != nil {
+				log.Fatal(err)
+			}
+			stderr, err := command.StderrPipe()
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := command.Start(); err != nil {
+				log.Fatal(err)
+			}
+			go pipeLines(lines, stdout, stderr)
+		} else {
+			go pipeLines(lines, os.Stdin)
+		}
+
+		ticker := time.NewTicker(pipeInterval)
+		defer ticker.Stop()
+		var batch []string
+		for done := false; !done; {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					done = true
+					break
+				}
+				if !pipeQuiet {
+					fmt.Println(line)
+				}
+				batch = append(batch, line)
+			case <-ticker.C:
+				postPipeBatch(batch)
+				batch = nil
+			}
+		}
+		postPipeBatch(batch)
+
+		if command == nil {
+			return
+		}
+
+		exitCode := 0
+		if err := command.Wait(); err != nil {
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				exitCode = exitErr.ExitCode()
+			} else {
+				log.Fatal(err)
+			}
+		}
+
+		duration := time.Since(started).Round(time.Second)
+		summary := fmt.Sprintf("`%s` finished with exit code **%d** in %s", strings.Join(args, " "), exitCode, duration)
+		if _, err := PostSparkMessage(&SparkMessageRequest{RoomID: pipeRoomID, MarkDown: summary}); err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to post the summary:", err)
+		}
+		os.Exit(exitCode)
+	},
+}
+
+func init() {
+	messagesCmd.AddCommand(messagesPipeCmd)
+
+	messagesPipeCmd.Flags().StringVarP(&pipeRoomID, "room", "r", "", "The room, by ID or name.")
+	messagesPipeCmd.Flags().DurationVarP(&pipeInterval, "interval", "i", 10*time.Second, "How often the output is posted.")
+	messagesPipeCmd.Flags().BoolVarP(&pipeQuiet, "quiet", "q", false, "Do not echo the output locally.")
+
+	setIDFlagType(messagesPipeCmd, "room", "ROOM")
+}
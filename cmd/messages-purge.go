@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/jbogarin/go-cisco-spark/ciscospark"
+	"github.com/spf13/cobra"
+)
+
+var purgeRoomID, purgeFrom, purgeOlderThan, purgeMatch, purgeReport string
+var purgeDryRun, purgeYes bool
+var purgeWorkers int
+var purgeRate float64
+
+// PurgeResult is the outcome of the deletion of a message by messages purge
+type PurgeResult struct {
+	ID          string `json:"id" csv:"id"`
+	Created     string `json:"created" csv:"created"`
+	PersonEmail string `json:"personEmail" csv:"personEmail"`
+	Text        string `json:"text" csv:"text"`
+	BulkStatus
+}
+
+// purgeCandidates walks the history of the room and returns the messages matching the purge policy
+func purgeCandidates(limiter *RateLimiter, fromID string, olderThan time.Time, match *regexp.Regexp) ([]*SparkMessage, error) {
+	var candidates []*SparkMessage
+	queryParams := &ciscospark.MessageQueryParams{
+		Max:    exportPageSize,
+		RoomID: purgeRoomID,
+	}
+	if !olderThan.IsZero() {
+		queryParams.Before = olderThan.UTC().Format(time.RFC3339)
+	}
+
+	for {
+		messages, err := ListSparkMessagesWithRetry(limiter, queryParams)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, message := range messages {
+			if fromID != "" && message.PersonID != fromID {
+				continue
+			}
+			if match != nil && !match.MatchString(message.Text) && !match.MatchString(message.MarkDown) {
+				continue
+			}
+			candidates = append(candidates, message)
+		}
+
+		if len(messages) < exportPageSize {
+			return candidates, nil
+		}
+		queryParams.Before = ""
+		queryParams.BeforeMessage = messages[len(messages)-1].ID
+	}
+}
+
+// deleteMessageWithRetry deletes a message through the rate limiter, retrying when the request is rate limited
+func deleteMessageWithRetry(limiter *RateLimiter, id string) error {
+	for {
+		limiter.Wait()
+		response, err := SparkClient.Messages.DeleteMessage(id)
+		if verbose && response != nil {
+			PrintRequestWithoutBody(response.Request)
+		}
+		if IsRateLimited(response) {
+			time.Sleep(RetryAfter(response, 10*time.Second))
+			continue
+		}
+		return err
+	}
+}
+
+// messagesPurgeCmd represents the messages purge command
+var messagesPurgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Delete the messages of a room matching a policy",
+	Long: `Deletes the messages of a room matching a policy, after listing them and asking for confirmation.
+
+Use -r/--room to define the room, a name only matching part of the room title is confirmed first and refused with -y/--yes.
+The policy is defined with:
+--from: only delete the messages of a person, by email address, ID, display name, or me for the authenticated user.
+--older-than: only delete the messages older than a duration, for example 90d.
+--match: only delete the messages matching a regular expression.
+
+Use --dry-run to only list the messages that would be deleted, and -y/--yes to skip the confirmation.
+The messages are deleted by -w/--workers workers, sharing --rate requests per second.
+Use --report to write the deleted messages to a CSV file.`,
+	PreRun: resolveRoomFlagsConfirmed(&purgeYes, "room"),
+	Run: func(cmd *cobra.Command, args []string) {
+		if purgeRoomID == "" {
+			fmt.Println(cmd.Help())
+			os.Exit(-1)
+		}
+		if purgeFrom == "" && purgeOlderThan == "" && purgeMatch == "" {
+			log.Fatal("define a policy with --from, --older-than or --match, purging every message is not allowed")
+		}
+
+		var match *regexp.Regexp
+		if purgeMatch != "" {
+			var err error
+			if match, err = regexp.Compile(purgeMatch); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		var fromID string
+		if purgeFrom != "" {
+			person, err := ResolvePerson(purgeFrom)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fromID = person.ID
+		}
+
+		var olderThan time.Time
+		if purgeOlderThan != "" {
+			age, err := ParseAge(purgeOlderThan)
+			if err != nil {
+				log.Fatal(err)
+			}
+			olderThan = time.Now().Add(-age)
+		}
+
+		limiter := NewRateLimiter(purgeRate)
+		candidates, err := purgeCandidates(limiter, fromID, olderThan, match)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, message := range candidates {
+			fmt.Fprintln(os.Stderr, FormatMessageLine(message))
+		}
+		fmt.Fprintf(os.Stderr, "%d messages match the policy\n", len(candidates))
+
+		if purgeDryRun || len(candidates) == 0 {
+			return
+		}
+		if !purgeYes && !Confirm(fmt.Sprintf("Delete %d messages?", len(candidates))) {
+			fmt.Fprintln(os.Stderr, "Aborted")
+			os.Exit(-1)
+		}
+
+		results := make([]*PurgeResult, len(candidates))
+		failed := RunBulk(len(candidates), purgeWorkers, func(index int) (string, *BulkStatus) {
+			message := candidates[index]
+			result := &PurgeResult{
+				ID:          message.ID,
+				PersonEmail: message.PersonEmail,
+				Text:        message.Text,
+			}
+			if message.Created != nil {
+				result.Created = message.Created.Format(time.RFC3339)
+			}
+			results[index] = result
+
+			if err := deleteMessageWithRetry(limiter, message.ID); err != nil {
+				result.Fail(err)
+			} else {
+				result.Status = "deleted"
+			}
+			return message.ID, &result.BulkStatus
+		})
+		FinishBulk(results, failed, purgeReport)
+	},
+}
+
+func init() {
+	messagesCmd.AddCommand(messagesPurgeCmd)
+
+	messagesPurgeCmd.Flags().StringVarP(&purgeRoomID, "room", "r", "", "The room, by ID or name.")
+	messagesPurgeCmd.Flags().StringVar(&purgeFrom, "from", "", "Only delete the messages of this person, by email address, ID, display name or me.")
+	messagesPurgeCmd.Flags().StringVar(&purgeOlderThan, "older-than", "", "Only delete the messages older than this duration, for example 90d.")
+	messagesPurgeCmd.Flags().StringVar(&purgeMatch, "match", "", "Only delete the messages matching this regular expression.")
+	messagesPurgeCmd.Flags().BoolVar(&purgeDryRun, "dry-run", false, "Only list the messages that would be deleted.")
+	messagesPurgeCmd.Flags().BoolVarP(&purgeYes, "yes", "y", false, "Do not ask for confirmation.")
+	messagesPurgeCmd.Flags().IntVarP(&purgeWorkers, "workers", "w", 4, "The number of messages deleted concurrently.")
+	messagesPurgeCmd.Flags().Float64Var(&purgeRate, "rate", 5, "The maximum number of requests per second.")
+	messagesPurgeCmd.Flags().StringVar(&purgeReport, "report", "", "Write the deleted messages to this CSV file.")
+
+	setIDFlagType(messagesPurgeCmd, "room", "ROOM")
+}
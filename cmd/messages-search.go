@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jbogarin/go-cisco-spark/ciscospark"
+	"github.com/spf13/cobra"
+)
+
+var searchQuery, searchRooms, searchFrom, searchSince, searchUntil string
+var searchWorkers int
+var searchRate float64
+
+// SearchMatch is a message matching a search, with the room it was posted in
+type SearchMatch struct {
+	RoomID            string        `json:"roomId"`
+	RoomTitle         string        `json:"roomTitle"`
+	Link              string        `json:"link"`
+	PersonDisplayName string        `json:"personDisplayName"`
+	Message           *SparkMessage `json:"message"`
+}
+
+// RoomLink returns the link opening a room in the Spark clients
+func RoomLink(roomID string) string {
+	return "webexteams://im?space=" + SparkIDUUID(roomID)
+}
+
+// searchRoomsSpec returns the rooms defined by --rooms: all, team:<id> or a comma separated list of room IDs
+func searchRoomsSpec(spec string) ([]*SparkRoom, error) {
+	switch {
+	case spec == "all":
+		return ListAllRooms(nil)
+	case strings.HasPrefix(spec, "team:"):
+		return ListAllRooms(&ciscospark.RoomQueryParams{TeamID: strings.TrimPrefix(spec, "team:")})
+	}
+
+	var rooms []*SparkRoom
+	for _, id := range strings.Split(spec, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		id, err := ResolveRoomID(id)
+		if err != nil {
+			return nil, err
+		}
+		room, _, err := SparkClient.Rooms.GetRoom(id)
+		if err != nil {
+			return nil, fmt.Errorf("room %s: %v", id, err)
+		}
+		rooms = append(rooms, &SparkRoom{ID: room.ID, Title: room.Title, TeamID: room.TeamID})
+	}
+	return rooms, nil
+}
+
+// searchRoom walks the history of a room from until back to since, sending the matching messages
+func searchRoom(room *SparkRoom, query *regexp.Regexp, since, until time.Time, limiter *RateLimiter, matches chan<- *SearchMatch) error {
+	queryParams := &ciscospark.MessageQueryParams{
+		Max:    exportPageSize,
+		RoomID: room.ID,
+	}
+	if !until.IsZero() {
+		queryParams.Before = until.UTC().Format(time.RFC3339)
+	}
+
+	for {
+		messages, err := ListSparkMessagesWithRetry(limiter, queryParams)
+		if err != nil {
+			return err
+		}
+
+		for _, message := range messages {
+			if !since.IsZero() && message.Created != nil && message.Created.Before(since) {
+				return nil
+			}
+			if searchFrom != "" && !strings.EqualFold(message.PersonEmail, searchFrom) {
+				continue
+			}
+			if !query.MatchString(message.Text) && !query.MatchString(message.MarkDown) {
+				continue
+			}
+
+			matches <- &SearchMatch{
+				RoomID:            room.ID,
+				RoomTitle:         room.Title,
+				Link:              RoomLink(room.ID),
+				PersonDisplayName: PersonDisplayName(message.PersonID, message.PersonEmail),
+				Message:           message,
+			}
+		}
+
+		if len(messages) < exportPageSize {
+			return nil
+		}
+		queryParams.Before = ""
+		queryParams.BeforeMessage = messages[len(messages)-1].ID
+	}
+}
+
+// messagesSearchCmd represents the messages search command
+var messagesSearchCmd = &cobra.Command{
+	Use:   "search",
+	Short: "Search messages across rooms",
+	Long: `Searches the messages of many rooms for a regular expression, printing the matches as they are found.
+
+Use -q/--query to define the regular expression.
+Use -r/--rooms to define the rooms: all, team:<team ID> or a comma separated list of room IDs.
+Use --from to only search the messages of a person, by email address, ID, display name or me.
+Use --since and --until to limit the dates, as ISO8601 dates or durations such as 7d.
+
+The rooms are searched concurrently by -w/--workers workers, sharing --rate requests per second.
+
+The matches are printed as text lines, use -f/--format json to print them as JSON lines.`,
+	PreRun: resolvePersonEmailFlags("from"),
+	Run: func(cmd *cobra.Command, args []string) {
+		if searchQuery == "" {
+			fmt.Println(cmd.Help())
+			os.Exit(-1)
+		}
+		asJSON := cmd.Flags().Changed("format") && format == "json"
+
+		query, err := regexp.Compile(searchQuery)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var since, until time.Time
+		if searchSince != "" {
+			if since, err = ParseTime(searchSince); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if searchUntil != "" {
+			if until, err = ParseTime(searchUntil); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		rooms, err := searchRoomsSpec(searchRooms)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// skip the rooms without activity in the searched period
+		var searched []*SparkRoom
+		for _, room := range rooms {
+			if !since.IsZero() && room.LastActivity != nil && room.LastActivity.Before(since) {
+				continue
+			}
+			searched = append(searched, room)
+		}
+
+		limiter := NewRateLimiter(searchRate)
+		roomsQueue := make(chan *SparkRoom)
+		matches := make(chan *SearchMatch)
+
+		if searchWorkers < 1 {
+			searchWorkers = 1
+		}
+		var workers sync.WaitGroup
+		for i := 0; i < searchWorkers; i++ {
+			workers.Add(1)
+			go func() {
+				defer workers.Done()
+				for room := range roomsQueue {
+					if err := searchRoom(room, query, since, until, limiter, matches); err != nil {
+						fmt.Fprintf(os.Stderr, "Unable to search %s: %v\n", room.Title, err)
+					}
+				}
+			}()
+		}
+		go func() {
+			for _, room := range searched {
+				roomsQueue <- room
+			}
+			close(roomsQueue)
+			workers.Wait()
+			close(matches)
+		}()
+
+		count := 0
+		for match := range matches {
+			count++
+			if asJSON {
+				matchJSON, err := json.Marshal(match)
+				if err != nil {
+					log.Fatal(err)
+				}
+				fmt.Println(string(matchJSON))
+				continue
+			}
+
+			body := match.Message.Text
+			if body == "" {
+				body = match.Message.MarkDown
+			}
+			var created string
+			if match.Message.Created != nil {
+				created = match.Message.Created.Local().Format("2006-01-02 15:04")
+			}
+			fmt.Printf("[%s] %s / %s: %s\n  %s\n", created, match.RoomTitle, match.PersonDisplayName, body, match.Link)
+		}
+		fmt.Fprintf(os.Stderr, "%d matches in %d rooms\n", count, len(searched))
+	},
+}
+
+func init() {
+	messagesCmd.AddCommand(messagesSearchCmd)
+
+	messagesSearchCmd.Flags().StringVarP(&searchQuery, "query", "q", "", "Regular expression to search for.")
+	messagesSearchCmd.Flags().StringVarP(&searchRooms, "rooms", "r", "all", "The rooms to search: all, team:<team ID> or a comma separated list of room IDs or names.")
+	messagesSearchCmd.Flags().StringVar(&searchFrom, "from", "", "Only search the messages of this person, by email address, ID, display name or me.")
+	messagesSearchCmd.Flags().StringVar(&searchSince, "since", "", "Only search the messages sent after this date or duration ago, for example 7d.")
+	messagesSearchCmd.Flags().StringVar(&searchUntil, "until", "", "Only search the messages sent before this date or duration ago.")
+	messagesSearchCmd.Flags().IntVarP(&searchWorkers, "workers", "w", 4, "The number of rooms searched concurrently.")
+	messagesSearchCmd.Flags().Float64Var(&searchRate, "rate", 5, "The maximum number of requests per second.")
+}
@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jbogarin/go-cisco-spark/ciscospark"
+	"github.com/spf13/cobra"
+)
+
+var tailRoomID string
+var tailLines int
+var tailFollow bool
+var tailMinInterval, tailMaxInterval time.Duration
+
+// tailPageSize is the number of messages requested on every poll
+const tailPageSize = 50
+
+// tailMaxSeen is the number of message IDs kept to de-duplicate messages
+const tailMaxSeen = 5000
+
+// FormatMessageLine formats a message as a single line with its local time and sender display name
+func FormatMessageLine(message *SparkMessage) string {
+	var created string
+	if message.Created != nil {
+		created = message.Created.Local().Format("2006-01-02 15:04:05")
+	}
+
+	body := message.Text
+	if body == "" {
+		body = message.MarkDown
+	}
+	if len(message.Files) > 0 {
+		body = strings.TrimSpace(fmt.Sprintf("%s [%d file(s)]", body, len(message.Files)))
+	}
+
+	return fmt.Sprintf("[%s] %s: %s", created, PersonDisplayName(message.PersonID, message.PersonEmail), body)
+}
+
+// printTailMessages prints the messages, oldest first
+func printTailMessages(messages []*SparkMessage, asJSON bool) {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if asJSON {
+			messageJSON, err := json.Marshal(messages[i])
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Println(string(messageJSON))
+		} else {
+			fmt.Println(FormatMessageLine(messages[i]))
+		}
+	}
+}
+
+// pollNewMessages returns the messages not seen yet, newest first, paging back until a seen message is found,
+// or a message older than newest, the creation date of the newest seen message, when the seen ones were deleted
+func pollNewMessages(roomID string, seen map[string]bool, newest time.Time) ([]*SparkMessage, *ciscospark.Response, error) {
+	var newMessages []*SparkMessage
+	queryParams := &ciscospark.MessageQueryParams{
+		Max:    tailPageSize,
+		RoomID: roomID,
+	}
+
+	for {
+		messages, response, err := ListSparkMessages(queryParams)
+		if err != nil {
+			return nil, response, err
+		}
+
+		for _, message := range messages {
+			if seen[message.ID] {
+				return newMessages, response, nil
+			}
+			if !newest.IsZero() && message.Created != nil && message.Created.Before(newest) {
+				return newMessages, response, nil
+			}
+			newMessages = append(newMessages, message)
+		}
+
+		if len(messages) < tailPageSize || len(seen) == 0 {
+			return newMessages, response, nil
+		}
+		queryParams.BeforeMessage = messages[len(messages)-1].ID
+	}
+}
+
+// messagesTailCmd represents the messages tail command
+var messagesTailCmd = &cobra.Command{
+	Use:   "tail",
+	Short: "Show the last messages of a room",
+	Long: `Shows the last messages of a room, oldest first, with the sender display names.
+
+Use -r/--room to define the room and -n/--lines to define the number of messages.
+
+Use -F/--follow to keep polling the room and print the new messages as they arrive. The poll interval grows
+from --min-interval to --max-interval while the room is quiet, and the requests back off when rate limited.
+
+The messages are printed as text lines, use -f/--format json to print them as JSON lines.`,
+	PreRun: resolveRoomFlags("room"),
+	Run: func(cmd *cobra.Command, args []string) {
+		asJSON := cmd.Flags().Changed("format") && format == "json"
+
+		var messages []*SparkMessage
+		for {
+			var response *ciscospark.Response
+			var err error
+			messages, response, err = ListSparkMessages(&ciscospark.MessageQueryParams{
+				Max:    tailLines,
+				RoomID: tailRoomID,
+			})
+			if IsRateLimited(response) {
+				wait := RetryAfter(response, tailMaxInterval)
+				fmt.Fprintln(os.Stderr, "Rate limited, retrying in", wait)
+				time.Sleep(wait)
+				continue
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+			break
+		}
+		printTailMessages(messages, asJSON)
+
+		if !tailFollow {
+			return
+		}
+
+		seen := make(map[string]bool)
+		var seenOrder []string
+		var newest time.Time
+		markSeen := func(messages []*SparkMessage) {
+			for i := len(messages) - 1; i >= 0; i-- {
+				seen[messages[i].ID] = true
+				seenOrder = append(seenOrder, messages[i].ID)
+				if created := messages[i].Created; created != nil && created.After(newest) {
+					newest = *created
+				}
+			}
+			if len(seenOrder) > tailMaxSeen {
+				for _, id := range seenOrder[:len(seenOrder)-tailMaxSeen/2] {
+					delete(seen, id)
+				}
+				seenOrder = append([]string(nil), seenOrder[len(seenOrder)-tailMaxSeen/2:]...)
+			}
+		}
+		markSeen(messages)
+
+		interval := tailMinInterval
+		for {
+			time.Sleep(interval)
+
+			newMessages, response, err := pollNewMessages(tailRoomID, seen, newest)
+			if IsRateLimited(response) {
+				interval = RetryAfter(response, 2*interval)
+				if interval > tailMaxInterval {
+					interval = tailMaxInterval
+				}
+				fmt.Fprintln(os.Stderr, "Rate limited, retrying in", interval)
+				continue
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+
+			if len(newMessages) > 0 {
+				interval = tailMinInterval
+			} else {
+				interval = interval * 3 / 2
+				if interval > tailMaxInterval {
+					interval = tailMaxInterval
+				}
+			}
+
+			markSeen(newMessages)
+			printTailMessages(newMessages, asJSON)
+		}
+	},
+}
+
+func init() {
+	messagesCmd.AddCommand(messagesTailCmd)
+
+	messagesTailCmd.Flags().StringVarP(&tailRoomID, "room", "r", "", "The room, by ID or name.")
+	messagesTailCmd.Flags().IntVarP(&tailLines, "lines", "n", 10, "The number of messages to show.")
+	messagesTailCmd.Flags().BoolVarP(&tailFollow, "follow", "F", false, "Keep polling the room for new messages.")
+	messagesTailCmd.Flags().DurationVar(&tailMinInterval, "min-interval", 2*time.Second, "The poll interval while the room is active.")
+	messagesTailCmd.Flags().DurationVar(&tailMaxInterval, "max-interval", 30*time.Second, "The maximum poll interval while the room is quiet.")
+
+	setIDFlagType(messagesTailCmd, "room", "ROOM")
+}
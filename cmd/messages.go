@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"log"
+	"strings"
 
 	"github.com/jbogarin/go-cisco-spark/ciscospark"
 	"github.com/spf13/cobra"
@@ -10,6 +11,9 @@ import (
 
 var roomID, markDownMessage, textMessage, messageID string
 var messagesBefore, messagesBeforeMessage, messagesMentionedPeople string
+var messagesMentions, messagesCardVars []string
+var messagesCard, messagesOverflow string
+var messagesQueue bool
 
 // messagesCmd represents the messages command
 var messagesCmd = &cobra.Command{
@@ -26,7 +30,11 @@ var messagesListCmd = &cobra.Command{
 	Short: "List messages",
 	Long: `Lists all messages in a room with roomType. If present, includes the associated media content attachment for each message. The roomType could be a group or direct(1:1).
 
-The list sorts the messages in descending order by creation date.`,
+The list sorts the messages in descending order by creation date.
+
+Use -f/--format chat to show the messages as a conversation, oldest first, with the sender names, the markdown
+rendered in the terminal and the replies indented under their parent.`,
+	PreRun: resolveRoomFlags("roomID"),
 	Run: func(cmd *cobra.Command, args []string) {
 		messageQueryParams := &ciscospark.MessageQueryParams{
 			Max:    Max,
@@ -45,6 +53,15 @@ The list sorts the messages in descending order by creation date.`,
 			messageQueryParams.MentionedPeople = messagesMentionedPeople
 		}
 
+		if format == "chat" {
+			messages, _, err := ListSparkMessages(messageQueryParams)
+			if err != nil {
+				log.Fatal(err)
+			}
+			PrintChat(messages)
+			return
+		}
+
 		messages, response, err := SparkClient.Messages.Get(messageQueryParams)
 		if verbose {
 			PrintRequestWithoutBody(response.Request)
@@ -60,8 +77,36 @@ The list sorts the messages in descending order by creation date.`,
 var messagesSendCmd = &cobra.Command{
 	Use:   "send",
 	Short: "Create a message",
-	Long:  `Posts a plain text message, and optionally, a media content attachment, to a room.`,
+	Long: `Posts a plain text message, and optionally, a media content attachment, to a room.
+
+Use --mention to mention people by email address, or write @{alice@example.com} inside the message.
+Use all (--mention all or @{all}) to mention everybody in the room. Messages with mentions are sent as markdown.
+
+Use -C/--card to attach an Adaptive Card from a JSON or YAML file. The card is validated before sending and
+-T/--text or -M/--markdown is required as the fallback for clients that cannot render cards.
+Use --card-var key=value to replace ${key} in the card.
+
+Use --template with --data to send a Go template rendered for every row of a CSV or YAML file, as markdown.
+Each row is sent to its email column as a 1:1 message, or to its room column, or to the -r/--roomID room.
+Use --dry-run to print the rendered messages. The status of every row is written to --results, and the rows already
+sent by a previous run are skipped. The rows are posted at --rate messages per second, the long ones as defined by --overflow.
+
+Messages over the Spark size limit are handled with --overflow: split sends them in numbered parts, split on
+paragraph and line boundaries with code fences reopened in every part, file attaches them as a file, and error fails.
+
+Use --queue to keep the message in the local outbox when it cannot be posted, for example while offline.
+The outbox is posted in order before the message, and what is left is posted later with go-spark outbox flush.`,
+	PreRun: resolveRoomFlags("roomID"),
 	Run: func(cmd *cobra.Command, args []string) {
+		if mergeTemplate != "" || mergeData != "" {
+			if mergeTemplate == "" || mergeData == "" {
+				log.Fatal("--template and --data must be used together")
+			}
+			if err := runMailMerge(); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
 
 		message := &ciscospark.MessageRequest{
 			RoomID: roomID,
@@ -75,6 +120,125 @@ var messagesSendCmd = &cobra.Command{
 			message.Text = ""
 		}
 
+		body := message.MarkDown
+		if body == "" {
+			body = message.Text
+		}
+		mentionedBody, mentioned, err := expandMentions(body, messagesMentions)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if mentioned {
+			message.MarkDown = mentionedBody
+			message.Text = ""
+		}
+
+		if messagesCard != "" {
+			if message.MarkDown == "" && message.Text == "" {
+				log.Fatal("a fallback -T/--text or -M/--markdown is required when sending a card")
+			}
+
+			vars, err := ParseCardVars(messagesCardVars)
+			if err != nil {
+				log.Fatal(err)
+			}
+			card, err := LoadAdaptiveCard(messagesCard, vars)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := ValidateAdaptiveCard(card); err != nil {
+				log.Fatal(err)
+			}
+
+			cardRequest := &SparkMessageRequest{
+				RoomID:   message.RoomID,
+				Text:     message.Text,
+				MarkDown: message.MarkDown,
+				Attachments: []Attachment{{
+					ContentType: AdaptiveCardContentType,
+					Content:     card,
+				}},
+			}
+			if messagesQueue {
+				sendQueued(cardRequest)
+				return
+			}
+			cardMessage, err := PostSparkMessage(cardRequest)
+			if err != nil {
+				log.Fatal(err)
+			}
+			PrintResponseFormat(cardMessage)
+			return
+		}
+
+		body = message.MarkDown
+		if body == "" {
+			body = message.Text
+		}
+		if len(body) > MaxMessageSize {
+			switch messagesOverflow {
+			case "error":
+				log.Fatalf("the message is %d bytes, the maximum is %d bytes", len(body), MaxMessageSize)
+			case "file":
+				if messagesQueue {
+					log.Fatal("--queue cannot be used with --overflow file")
+				}
+				fileName, notice := "message.txt", "The message is too long, it is attached as message.txt"
+				if message.MarkDown != "" {
+					fileName, notice = "message.md", "The message is too long, it is attached as message.md"
+				}
+				fileMessage, err := PostSparkMessageFile(&SparkMessageRequest{
+					RoomID: message.RoomID,
+					Text:   notice,
+				}, fileName, strings.NewReader(body))
+				if err != nil {
+					log.Fatal(err)
+				}
+				PrintResponseFormat(fileMessage)
+			case "split":
+				if messagesQueue {
+					var partRequests []*SparkMessageRequest
+					for _, part := range SplitMessage(body, MaxMessageSize) {
+						if message.MarkDown != "" {
+							partRequests = append(partRequests, &SparkMessageRequest{RoomID: message.RoomID, MarkDown: part})
+						} else {
+							partRequests = append(partRequests, &SparkMessageRequest{RoomID: message.RoomID, Text: part})
+						}
+					}
+					sendQueued(partRequests...)
+					return
+				}
+
+				var parts []*ciscospark.Message
+				for _, part := range SplitMessage(body, MaxMessageSize) {
+					partRequest := &ciscospark.MessageRequest{RoomID: message.RoomID}
+					if message.MarkDown != "" {
+						partRequest.MarkDown = part
+					} else {
+						partRequest.Text = part
+					}
+
+					newMessage, response, err := SparkClient.Messages.Post(partRequest)
+					if verbose {
+						PrintRequestWithBody(response.Request, partRequest)
+					}
+					if err != nil {
+						log.Fatal(err)
+					}
+					parts = append(parts, newMessage)
+				}
+				PrintResponseFormat(parts)
+			default:
+				log.Fatalf("unsupported overflow %s, use split, file or error", messagesOverflow)
+			}
+			return
+		}
+
+		if messagesQueue {
+			sendQueued(&SparkMessageRequest{RoomID: message.RoomID, Text: message.Text, MarkDown: message.MarkDown})
+			return
+		}
+
 		newMessage, response, err := SparkClient.Messages.Post(message)
 		if verbose {
 			PrintRequestWithBody(response.Request, message)
@@ -92,8 +256,18 @@ var messagesGetCmd = &cobra.Command{
 	Short: "Get message details",
 	Long: `Shows details for a message, by message ID.
 
-Specify the message ID in the messageId parameter in the URI.`,
+Specify the message ID in the messageId parameter in the URI.
+
+Use -f/--format chat to show the message rendered in the terminal.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		if format == "chat" {
+			message, err := GetSparkMessage(messageID)
+			if err != nil {
+				log.Fatal(err)
+			}
+			PrintChat([]*SparkMessage{message})
+			return
+		}
 
 		message, response, err := SparkClient.Messages.GetMessage(messageID)
 		if verbose {
@@ -136,17 +310,32 @@ func init() {
 	messagesCmd.AddCommand(messagesGetCmd)
 	messagesCmd.AddCommand(messagesDeleteCmd)
 
-	messagesListCmd.Flags().StringVarP(&roomID, "roomID", "r", "", "List messages for a room, by ID.")
+	messagesListCmd.Flags().StringVarP(&roomID, "roomID", "r", "", "List messages for a room, by ID or name.")
 	messagesListCmd.Flags().StringVarP(&messagesBefore, "before", "b", "", "List messages sent before a date and time, in ISO8601 format.")
 	messagesListCmd.Flags().StringVarP(&messagesBeforeMessage, "before-message", "B", "", "List messages sent before a message, by ID.")
 	messagesListCmd.Flags().StringVarP(&messagesMentionedPeople, "mentioned-people", "M", "", "List messages for a person, by personId or me.")
 
-	messagesSendCmd.Flags().StringVarP(&roomID, "roomID", "r", "", "The room ID.")
+	messagesSendCmd.Flags().StringVarP(&roomID, "roomID", "r", "", "The room, by ID or name.")
 	messagesSendCmd.Flags().StringVarP(&markDownMessage, "markdown", "M", "", "The message, in markdown format.")
 	messagesSendCmd.Flags().StringVarP(&textMessage, "text", "T", "", "The message, in plain text.")
+	messagesSendCmd.Flags().StringVarP(&messagesCard, "card", "C", "", "Adaptive Card to attach, from a JSON or YAML file.")
+	messagesSendCmd.Flags().StringSliceVar(&messagesCardVars, "card-var", []string{}, "Card variable, in key=value format. Can be repeated.")
+	messagesSendCmd.Flags().StringVar(&messagesOverflow, "overflow", "split", "What to do with messages over the size limit: split, file or error.")
+	messagesSendCmd.Flags().StringVar(&mergeTemplate, "template", "", "Go template of the message, rendered for every row of --data.")
+	messagesSendCmd.Flags().StringVar(&mergeData, "data", "", "CSV or YAML file with the template data, one message per row.")
+	messagesSendCmd.Flags().StringVar(&mergeResults, "results", "", "CSV file with the result of every row (default is <data>.results.csv).")
+	messagesSendCmd.Flags().Float64Var(&mergeRate, "rate", 5, "The maximum number of messages posted per second with --data.")
+	messagesSendCmd.Flags().BoolVar(&mergeDryRun, "dry-run", false, "Only print the rendered messages.")
+	messagesSendCmd.Flags().BoolVar(&messagesQueue, "queue", false, "Keep the message in the outbox when it cannot be posted.")
+	messagesSendCmd.Flags().StringSliceVar(&messagesMentions, "mention", []string{}, "Mention a person by email address, or all to mention everybody. Can be repeated.")
 
 	messagesGetCmd.Flags().StringVarP(&messageID, "id", "i", "", "The message ID")
 
 	messagesDeleteCmd.Flags().StringVarP(&messageID, "id", "i", "", "The message ID")
 
+	setIDFlagType(messagesListCmd, "roomID", "ROOM")
+	setIDFlagType(messagesListCmd, "before-message", "MESSAGE")
+	setIDFlagType(messagesSendCmd, "roomID", "ROOM")
+	setIDFlagType(messagesGetCmd, "id", "MESSAGE")
+	setIDFlagType(messagesDeleteCmd, "id", "MESSAGE")
 }
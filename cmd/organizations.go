@@ -64,4 +64,6 @@ func init() {
 	organizationsCmd.AddCommand(organizationsGetCmd)
 
 	organizationsGetCmd.Flags().StringVarP(&organizationID, "id", "i", "", "The organization ID")
+
+	setIDFlagType(organizationsGetCmd, "id", "ORGANIZATION")
 }
@@ -0,0 +1,420 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jbogarin/go-cisco-spark/ciscospark"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var outboxEntryID string
+var outboxDropAll bool
+
+// outboxCheckWindow is the clock skew tolerated between the computer and Spark when looking for a message
+// posted by a previous attempt: the messages created up to this long before the attempt are checked too
+const outboxCheckWindow = 2 * time.Minute
+
+// OutboxEntry is a message waiting in the outbox
+type OutboxEntry struct {
+	ID        string               `json:"id" csv:"id"`
+	Queued    time.Time            `json:"queued" csv:"queued"`
+	Attempted *time.Time           `json:"attempted,omitempty" csv:"attempted"`
+	Attempts  int                  `json:"attempts" csv:"attempts"`
+	LastError string               `json:"lastError,omitempty" csv:"lastError"`
+	Request   *SparkMessageRequest `json:"request" csv:"-"`
+}
+
+// OutboxClaim is a message posted for an outbox entry, kept so it is not matched again with another entry
+type OutboxClaim struct {
+	MessageID string    `json:"messageId"`
+	Created   time.Time `json:"created"`
+}
+
+// outboxFile is the content of the outbox file
+type outboxFile struct {
+	Entries []*OutboxEntry `json:"entries"`
+	Claimed []*OutboxClaim `json:"claimed,omitempty"`
+}
+
+// claim records a message posted for an entry
+func (o *outboxFile) claim(message *SparkMessage) {
+	created := time.Now()
+	if message.Created != nil {
+		created = *message.Created
+	}
+	o.Claimed = append(o.Claimed, &OutboxClaim{MessageID: message.ID, Created: created})
+}
+
+// claimedIDs returns the IDs of the messages already matched with an entry
+func (o *outboxFile) claimedIDs() map[string]bool {
+	claimed := make(map[string]bool)
+	for _, claim := range o.Claimed {
+		claimed[claim.MessageID] = true
+	}
+	return claimed
+}
+
+// outboxPath returns the outbox file, outbox in the config file or $HOME/.go-spark-outbox.json
+func outboxPath() string {
+	if viper.IsSet("outbox") {
+		return viper.GetString("outbox")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return filepath.Join(home, ".go-spark-outbox.json")
+}
+
+// lockOutbox prevents two go-spark processes from flushing the outbox at the same time, which would post messages twice
+func lockOutbox() (func(), error) {
+	lock := outboxPath() + ".lock"
+	file, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("the outbox is used by another go-spark, remove %s if it is not running", lock)
+	}
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+	return func() { os.Remove(lock) }, nil
+}
+
+// readOutbox reads the outbox, with its entries oldest first. An outbox written as a list of entries is read too.
+func readOutbox() (*outboxFile, error) {
+	outbox := new(outboxFile)
+	content, err := ioutil.ReadFile(outboxPath())
+	if os.IsNotExist(err) {
+		return outbox, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(content)) > 0 && bytes.TrimSpace(content)[0] == '[' {
+		err = json.Unmarshal(content, &outbox.Entries)
+	} else {
+		err = json.Unmarshal(content, outbox)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", outboxPath(), err)
+	}
+	return outbox, nil
+}
+
+// writeOutbox replaces the outbox, through a temporary file so the outbox is never left half written.
+// The claimed messages created before the check window of the oldest attempt, or of an attempt made now,
+// can no longer be matched and are dropped.
+func writeOutbox(outbox *outboxFile) error {
+	oldest := time.Now()
+	for _, entry := range outbox.Entries {
+		if entry.Attempted != nil && entry.Attempted.Before(oldest) {
+			oldest = *entry.Attempted
+		}
+	}
+	var claimed []*OutboxClaim
+	for _, claim := range outbox.Claimed {
+		if !claim.Created.Before(oldest.Add(-outboxCheckWindow)) {
+			claimed = append(claimed, claim)
+		}
+	}
+	outbox.Claimed = claimed
+
+	content, err := json.MarshalIndent(outbox, "", "  ")
+	if err != nil {
+		return err
+	}
+	partial := outboxPath() + ".part"
+	if err := ioutil.WriteFile(partial, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(partial, outboxPath())
+}
+
+// newOutboxID returns a random ID for an outbox entry, used to show and drop it
+func newOutboxID() string {
+	key := make([]byte, 8)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatal(err)
+	}
+	return hex.EncodeToString(key)
+}
+
+// listDirectMessages lists the 1:1 messages with a person, newest first
+func listDirectMessages(messageRequest *SparkMessageRequest) ([]*SparkMessage, error) {
+	query := url.Values{}
+	if messageRequest.ToPersonID != "" {
+		query.Set("personId", messageRequest.ToPersonID)
+	} else {
+		query.Set("personEmail", messageRequest.ToPersonEmail)
+	}
+
+	request, err := SparkClient.NewRequest("GET", "messages/direct?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	page := new(sparkMessagesPage)
+	response, err := SparkClient.Do(request, page)
+	if verbose && response != nil {
+		PrintRequestWithoutBody(response.Request)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return page.Items, nil
+}
+
+// findPostedEntry looks for the message of an entry among the messages posted since its last attempt,
+// minus outboxCheckWindow for the clock skew, skipping the messages already claimed by other entries.
+// A request that timed out may have been posted anyway, so it is only retried when its message is not found.
+func findPostedEntry(entry *OutboxEntry, meID string, claimed map[string]bool) (*SparkMessage, error) {
+	var messages []*SparkMessage
+	var err error
+	if entry.Request.RoomID != "" {
+		messages, _, err = ListSparkMessages(&ciscospark.MessageQueryParams{RoomID: entry.Request.RoomID, Max: 50})
+	} else {
+		messages, err = listDirectMessages(entry.Request)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, message := range messages {
+		if message.Created != nil && message.Created.Before(entry.Attempted.Add(-outboxCheckWindow)) {
+			break
+		}
+		if claimed[message.ID] || message.PersonID != meID || message.ParentID != entry.Request.ParentID {
+			continue
+		}
+		if entry.Request.MarkDown != "" && message.MarkDown == entry.Request.MarkDown ||
+			entry.Request.MarkDown == "" && message.Text == entry.Request.Text {
+			return message, nil
+		}
+	}
+	return nil, nil
+}
+
+// isDefinitelyNotPosted returns true when the response shows the message was rejected, and not lost on its way back
+func isDefinitelyNotPosted(response *ciscospark.Response) bool {
+	return response != nil && response.Response != nil &&
+		response.StatusCode >= http.StatusBadRequest && response.StatusCode < http.StatusInternalServerError
+}
+
+// FlushOutbox posts the outbox messages in order and returns the messages posted.
+// It stops at the first message that cannot be posted, which stays in the outbox with the following ones.
+func FlushOutbox() ([]*SparkMessage, error) {
+	unlock, err := lockOutbox()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	outbox, err := readOutbox()
+	if err != nil {
+		return nil, err
+	}
+
+	var posted []*SparkMessage
+	var meID string
+	for len(outbox.Entries) > 0 {
+		entry := outbox.Entries[0]
+
+		if entry.Attempted != nil {
+			if meID == "" {
+				me, _, err := SparkClient.People.GetMe()
+				if err != nil {
+					return posted, err
+				}
+				meID = me.ID
+			}
+			message, err := findPostedEntry(entry, meID, outbox.claimedIDs())
+			if err != nil {
+				return posted, err
+			}
+			if message != nil {
+				outbox.claim(message)
+				posted = append(posted, message)
+				outbox.Entries = outbox.Entries[1:]
+				if err := writeOutbox(outbox); err != nil {
+					return posted, err
+				}
+				continue
+			}
+		}
+
+		// the attempt is saved first: if go-spark dies during the request, the next flush checks for the message
+		now := time.Now()
+		entry.Attempted = &now
+		entry.Attempts++
+		if err := writeOutbox(outbox); err != nil {
+			return posted, err
+		}
+
+		message, response, err := postSparkMessage(entry.Request)
+		if err != nil {
+			entry.LastError = err.Error()
+			if isDefinitelyNotPosted(response) {
+				entry.Attempted = nil
+			}
+			if err := writeOutbox(outbox); err != nil {
+				return posted, err
+			}
+			return posted, fmt.Errorf("unable to post %s: %v", entry.ID, entry.LastError)
+		}
+
+		outbox.claim(message)
+		posted = append(posted, message)
+		outbox.Entries = outbox.Entries[1:]
+		if err := writeOutbox(outbox); err != nil {
+			return posted, err
+		}
+	}
+	return posted, nil
+}
+
+// QueueMessages adds the message requests at the end of the outbox
+func QueueMessages(messageRequests ...*SparkMessageRequest) ([]*OutboxEntry, error) {
+	unlock, err := lockOutbox()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	outbox, err := readOutbox()
+	if err != nil {
+		return nil, err
+	}
+	var queued []*OutboxEntry
+	for _, messageRequest := range messageRequests {
+		entry := &OutboxEntry{ID: newOutboxID(), Queued: time.Now(), Request: messageRequest}
+		outbox.Entries = append(outbox.Entries, entry)
+		queued = append(queued, entry)
+	}
+	return queued, writeOutbox(outbox)
+}
+
+// DropOutbox removes a message from the outbox, or every message when all is true, and returns the messages removed
+func DropOutbox(id string, all bool) ([]*OutboxEntry, error) {
+	unlock, err := lockOutbox()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	outbox, err := readOutbox()
+	if err != nil {
+		return nil, err
+	}
+	var kept, dropped []*OutboxEntry
+	for _, entry := range outbox.Entries {
+		if all || entry.ID == id {
+			dropped = append(dropped, entry)
+		} else {
+			kept = append(kept, entry)
+		}
+	}
+	if len(dropped) == 0 && !all {
+		return nil, fmt.Errorf("message %s not found in the outbox", id)
+	}
+	outbox.Entries = kept
+	return dropped, writeOutbox(outbox)
+}
+
+// sendQueued queues the message requests and flushes the outbox, printing the messages posted
+func sendQueued(messageRequests ...*SparkMessageRequest) {
+	queued, err := QueueMessages(messageRequests...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	posted, err := FlushOutbox()
+	if len(posted) > 0 {
+		PrintResponseFormat(posted)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		for _, entry := range queued {
+			fmt.Fprintf(os.Stderr, "Message %s is in the outbox, post it later with go-spark outbox flush\n", entry.ID)
+		}
+	}
+}
+
+// outboxCmd represents the outbox command
+var outboxCmd = &cobra.Command{
+	Use:   "outbox",
+	Short: "Messages waiting to be sent",
+	Long: `The outbox keeps the messages sent with messages send --queue until they are posted.
+
+The outbox is $HOME/.go-spark-outbox.json, set outbox in the config file to use another file.`,
+}
+
+// outboxListCmd represents the outbox list command
+var outboxListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the messages in the outbox",
+	Long:  `Lists the messages in the outbox, in the order they will be posted.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		outbox, err := readOutbox()
+		if err != nil {
+			log.Fatal(err)
+		}
+		PrintResponseFormat(outbox.Entries)
+	},
+}
+
+// outboxFlushCmd represents the outbox flush command
+var outboxFlushCmd = &cobra.Command{
+	Use:   "flush",
+	Short: "Post the messages in the outbox",
+	Long: `Posts the messages in the outbox, in order, and stops at the first message that cannot be posted.
+
+A message whose previous attempt failed without an answer from Spark, such as a timeout, may have been posted anyway:
+it is only posted again when it is not found among the recent messages of its room.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		posted, err := FlushOutbox()
+		PrintResponseFormat(posted)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// outboxDropCmd represents the outbox drop command
+var outboxDropCmd = &cobra.Command{
+	Use:   "drop",
+	Short: "Remove messages from the outbox",
+	Long:  `Removes a message from the outbox, by ID, or every message with --all.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if outboxEntryID == "" && !outboxDropAll {
+			fmt.Println(cmd.Help())
+			os.Exit(-1)
+		}
+
+		dropped, err := DropOutbox(outboxEntryID, outboxDropAll)
+		if err != nil {
+			log.Fatal(err)
+		}
+		PrintResponseFormat(dropped)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(outboxCmd)
+	outboxCmd.AddCommand(outboxListCmd)
+	outboxCmd.AddCommand(outboxFlushCmd)
+	outboxCmd.AddCommand(outboxDropCmd)
+
+	outboxDropCmd.Flags().StringVarP(&outboxEntryID, "id", "i", "", "The outbox message ID.")
+	outboxDropCmd.Flags().BoolVar(&outboxDropAll, "all", false, "Remove every message.")
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"log"
+	"sync"
 
 	"github.com/jbogarin/go-cisco-spark/ciscospark"
 	"github.com/spf13/cobra"
@@ -9,6 +10,33 @@ import (
 
 var peopleName, peopleEmail, personID string
 
+// personNames caches the display names of the people, by ID
+var personNames = struct {
+	sync.Mutex
+	names map[string]string
+}{names: make(map[string]string)}
+
+// PersonDisplayName returns the display name of a person, by ID, falling back to the fallback value when the person cannot be found
+func PersonDisplayName(id, fallback string) string {
+	personNames.Lock()
+	name, ok := personNames.names[id]
+	personNames.Unlock()
+	if ok {
+		return name
+	}
+
+	name = fallback
+	person, _, err := SparkClient.People.GetPerson(id)
+	if err == nil && person.DisplayName != "" {
+		name = person.DisplayName
+	}
+
+	personNames.Lock()
+	personNames.names[id] = name
+	personNames.Unlock()
+	return name
+}
+
 // peopleCmd represents the people command
 var peopleCmd = &cobra.Command{
 	Use:   "people",
@@ -69,7 +97,8 @@ var peopleGetCmd = &cobra.Command{
 	Short: "Get person details",
 	Long: `Shows details for a person, by ID.
 
-Specify the person ID with the -i/--id flag.`,
+Specify the person with the -i/--id flag, by ID, email address, display name or me.`,
+	PreRun: resolvePersonFlags("id"),
 	Run: func(cmd *cobra.Command, args []string) {
 		person, response, err := SparkClient.People.GetPerson(personID)
 		if verbose {
@@ -92,5 +121,7 @@ func init() {
 	peopleListCmd.Flags().StringVarP(&peopleName, "name", "n", "", "List people whose name starts with this string.")
 	peopleListCmd.Flags().StringVarP(&peopleEmail, "email", "e", "", "List people with this email address.")
 
-	peopleGetCmd.Flags().StringVarP(&personID, "id", "i", "", "The person ID")
+	peopleGetCmd.Flags().StringVarP(&personID, "id", "i", "", "The person, by ID, email address, display name or me")
+
+	setIDFlagType(peopleGetCmd, "id", "PEOPLE")
 }
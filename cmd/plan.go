@@ -0,0 +1,568 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jbogarin/go-cisco-spark/ciscospark"
+	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var planFile string
+var applyYes bool
+var applyRate float64
+
+// SpacesSpec describes the teams, rooms and memberships managed by plan and apply
+type SpacesSpec struct {
+	Teams []*TeamSpec `yaml:"teams"`
+	Rooms []*RoomSpec `yaml:"rooms"`
+}
+
+// TeamSpec describes a team, its members and its rooms
+type TeamSpec struct {
+	ID         string      `yaml:"id"`
+	Name       string      `yaml:"name"`
+	Members    []string    `yaml:"members"`
+	Moderators []string    `yaml:"moderators"`
+	Rooms      []*RoomSpec `yaml:"rooms"`
+}
+
+// RoomSpec describes a room and its members
+type RoomSpec struct {
+	ID         string   `yaml:"id"`
+	Title      string   `yaml:"title"`
+	Members    []string `yaml:"members"`
+	Moderators []string `yaml:"moderators"`
+}
+
+// PlanAction is a change needed to make the live state match the spec
+type PlanAction struct {
+	Action string `json:"action" csv:"action"`
+	Kind   string `json:"kind" csv:"kind"`
+	Target string `json:"target" csv:"target"`
+	Person string `json:"person,omitempty" csv:"person"`
+	Detail string `json:"detail,omitempty" csv:"detail"`
+	apply  func() error
+}
+
+// String returns the action as a line of the plan
+func (a *PlanAction) String() string {
+	switch a.Action {
+	case "create":
+		return fmt.Sprintf("+ create %s %q%s", a.Kind, a.Target, a.Detail)
+	case "rename":
+		return fmt.Sprintf("~ rename %s %q to %q", a.Kind, a.Target, a.Detail)
+	case "add":
+		return fmt.Sprintf("+ add %s to %s %q%s", a.Person, a.Kind, a.Target, a.Detail)
+	case "remove":
+		return fmt.Sprintf("- remove %s from %s %q", a.Person, a.Kind, a.Target)
+	default:
+		return fmt.Sprintf("~ make %s %s of %s %q", a.Person, a.Detail, a.Kind, a.Target)
+	}
+}
+
+// liveMember is a membership of a team or a room
+type liveMember struct {
+	id        string
+	personID  string
+	email     string
+	moderator bool
+}
+
+// memberOps are the calls changing the memberships of a team or a room, whose ID is known when the plan is applied
+type memberOps struct {
+	add    func(email string, moderator bool) error
+	update func(id string, moderator bool) error
+	remove func(id string) error
+}
+
+// spacesPlanner compares the spec with the live state and collects the actions.
+// The limiter paces the requests made when the actions are applied.
+type spacesPlanner struct {
+	me        *ciscospark.Person
+	rooms     []*SparkRoom
+	teamRooms map[string][]*SparkRoom
+	limiter   *RateLimiter
+	actions   []*PlanAction
+}
+
+// loadSpacesSpec reads a spec from a YAML file
+func loadSpacesSpec(path string) (*SpacesSpec, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	spec := new(SpacesSpec)
+	if err := yaml.UnmarshalStrict(content, spec); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for _, team := range spec.Teams {
+		if team.Name == "" {
+			return nil, fmt.Errorf("%s: a team has no name", path)
+		}
+		for _, room := range team.Rooms {
+			if room.Title == "" {
+				return nil, fmt.Errorf("%s: a room of the team %s has no title", path, team.Name)
+			}
+		}
+	}
+	for _, room := range spec.Rooms {
+		if room.Title == "" {
+			return nil, fmt.Errorf("%s: a room has no title", path)
+		}
+	}
+	return spec, nil
+}
+
+// specPersonEmail returns the lowercase email address of a person of the spec, given by email, ID or display name
+func specPersonEmail(value string) (string, error) {
+	if strings.Contains(value, "@") {
+		return strings.ToLower(strings.TrimSpace(value)), nil
+	}
+	person, err := ResolvePerson(value)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(PersonEmail(person)), nil
+}
+
+// wantedMembers returns the members of the spec by email, with whether they are moderators. Moderators are members too.
+func wantedMembers(members, moderators []string) (map[string]bool, error) {
+	wanted := make(map[string]bool)
+	for _, member := range members {
+		email, err := specPersonEmail(member)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := wanted[email]; !ok {
+			wanted[email] = false
+		}
+	}
+	for _, moderator := range moderators {
+		email, err := specPersonEmail(moderator)
+		if err != nil {
+			return nil, err
+		}
+		wanted[email] = true
+	}
+	return wanted, nil
+}
+
+// add appends an action to the plan
+func (p *spacesPlanner) add(action *PlanAction) {
+	p.actions = append(p.actions, action)
+}
+
+// planMembers compares the wanted members with the live ones. The authenticated user is never removed.
+func (p *spacesPlanner) planMembers(kind, target string, live []*liveMember, wanted map[string]bool, ops *memberOps) {
+	byEmail := make(map[string]*liveMember)
+	for _, member := range live {
+		byEmail[member.email] = member
+	}
+
+	emails := make([]string, 0, len(wanted))
+	for email := range wanted {
+		emails = append(emails, email)
+	}
+	sort.Strings(emails)
+	for _, email := range emails {
+		email, moderator := email, wanted[email]
+		member, ok := byEmail[email]
+		switch {
+		case !ok && live == nil && strings.EqualFold(email, PersonEmail(p.me)):
+			// the authenticated user is the creator of the new team or room
+		case !ok:
+			detail := ""
+			if moderator {
+				detail = " as moderator"
+			}
+			p.add(&PlanAction{Action: "add", Kind: kind, Target: target, Person: email, Detail: detail,
+				apply: func() error { return ops.add(email, moderator) }})
+		case member.moderator != moderator:
+			detail := "a member"
+			if moderator {
+				detail = "a moderator"
+			}
+			p.add(&PlanAction{Action: "moderator", Kind: kind, Target: target, Person: email, Detail: detail,
+				apply: func() error { return ops.update(member.id, moderator) }})
+		}
+	}
+
+	for _, member := range live {
+		member := member
+		if _, ok := wanted[member.email]; ok || member.personID == p.me.ID {
+			continue
+		}
+		p.add(&PlanAction{Action: "remove", Kind: kind, Target: target, Person: member.email,
+			apply: func() error { return ops.remove(member.id) }})
+	}
+}
+
+// roomMemberOps returns the membership calls of a room
+func roomMemberOps(limiter *RateLimiter, roomID *string) *memberOps {
+	return &memberOps{
+		add: func(email string, moderator bool) error {
+			_, err := PostMembershipWithRetry(limiter, &ciscospark.MembershipRequest{RoomID: *roomID, PersonEmail: email, IsModerator: moderator})
+			return err
+		},
+		update: func(id string, moderator bool) error {
+			_, err := UpdateMembershipWithRetry(limiter, id, &ciscospark.UpdateMembershipRequest{IsModerator: moderator})
+			return err
+		},
+		remove: func(id string) error {
+			return DeleteMembershipWithRetry(limiter, id)
+		},
+	}
+}
+
+// teamMemberOps returns the membership calls of a team
+func teamMemberOps(limiter *RateLimiter, teamID *string) *memberOps {
+	return &memberOps{
+		add: func(email string, moderator bool) error {
+			_, err := PostTeamMembershipWithRetry(limiter, &ciscospark.TeamMembershipRequest{TeamID: *teamID, PersonEmail: email, IsModerator: moderator})
+			return err
+		},
+		update: func(id string, moderator bool) error {
+			_, err := UpdateTeamMembershipWithRetry(limiter, id, &ciscospark.UpdateTeamMembershipRequest{IsModerator: moderator})
+			return err
+		},
+		remove: func(id string) error {
+			return DeleteTeamMembershipWithRetry(limiter, id)
+		},
+	}
+}
+
+// findRoom returns the live room of a spec among the rooms of a team, or the rooms outside of teams when teamID is empty.
+// The rooms of a team are listed with the teamId filter, which also returns the team rooms the authenticated user has not joined.
+func (p *spacesPlanner) findRoom(spec *RoomSpec, teamID string) (*SparkRoom, error) {
+	rooms := p.rooms
+	if teamID != "" {
+		if _, ok := p.teamRooms[teamID]; !ok {
+			listed, err := ListAllRooms(&ciscospark.RoomQueryParams{TeamID: teamID})
+			if err != nil {
+				return nil, err
+			}
+			p.teamRooms[teamID] = listed
+		}
+		rooms = p.teamRooms[teamID]
+	}
+
+	var found []*SparkRoom
+	for _, room := range rooms {
+		switch {
+		case spec.ID != "" && room.ID == spec.ID:
+			if room.TeamID != teamID {
+				return nil, fmt.Errorf("room %q: moving a room to another team is not supported", spec.Title)
+			}
+			return room, nil
+		case spec.ID == "" && room.TeamID == teamID && room.Type != "direct" && room.Title == spec.Title:
+			found = append(found, room)
+		}
+	}
+	if spec.ID != "" {
+		return nil, fmt.Errorf("room %q: the room %s was not found", spec.Title, spec.ID)
+	}
+	if len(found) > 1 {
+		return nil, fmt.Errorf("room %q: %d rooms have this title, add the id of the room to the spec", spec.Title, len(found))
+	}
+	if len(found) == 1 {
+		return found[0], nil
+	}
+	return nil, nil
+}
+
+// planRoom plans the creation or the update of a room and its memberships
+func (p *spacesPlanner) planRoom(spec *RoomSpec, teamID *string, teamName string) error {
+	wanted, err := wantedMembers(spec.Members, spec.Moderators)
+	if err != nil {
+		return fmt.Errorf("room %q: %v", spec.Title, err)
+	}
+
+	var room *SparkRoom
+	if *teamID != "" || teamName == "" {
+		if room, err = p.findRoom(spec, *teamID); err != nil {
+			return err
+		}
+	}
+
+	roomID := new(string)
+	var live []*liveMember
+	if room == nil {
+		detail := ""
+		if teamName != "" {
+			detail = fmt.Sprintf(" in team %q", teamName)
+		}
+		p.add(&PlanAction{Action: "create", Kind: "room", Target: spec.Title, Detail: detail, apply: func() error {
+			p.limiter.Wait()
+			room, _, err := SparkClient.Rooms.Post(&ciscospark.RoomRequest{Title: spec.Title, TeamID: *teamID})
+			if err == nil {
+				*roomID = room.ID
+			}
+			return err
+		}})
+	} else {
+		*roomID = room.ID
+		if room.Title != spec.Title {
+			p.add(&PlanAction{Action: "rename", Kind: "room", Target: room.Title, Detail: spec.Title, apply: func() error {
+				p.limiter.Wait()
+				_, _, err := SparkClient.Rooms.UpdateRoom(room.ID, &ciscospark.UpdateRoomRequest{Title: spec.Title})
+				return err
+			}})
+		}
+
+		memberships, err := ListAllMemberships(room.ID)
+		if err != nil {
+			return err
+		}
+		live = []*liveMember{}
+		for _, membership := range memberships {
+			if membership.IsMonitor {
+				continue
+			}
+			live = append(live, &liveMember{id: membership.ID, personID: membership.PersonID,
+				email: strings.ToLower(membership.PersonEmail), moderator: membership.IsModerator})
+		}
+	}
+
+	p.planMembers("room", spec.Title, live, wanted, roomMemberOps(p.limiter, roomID))
+	return nil
+}
+
+// planTeam plans the creation or the update of a team, its memberships and its rooms
+func (p *spacesPlanner) planTeam(spec *TeamSpec, teams []*ciscospark.Team) error {
+	wanted, err := wantedMembers(spec.Members, spec.Moderators)
+	if err != nil {
+		return fmt.Errorf("team %q: %v", spec.Name, err)
+	}
+
+	var team *ciscospark.Team
+	for _, candidate := range teams {
+		if spec.ID != "" && candidate.ID == spec.ID || spec.ID == "" && candidate.Name == spec.Name {
+			if team != nil {
+				return fmt.Errorf("team %q: several teams have this name, add the id of the team to the spec", spec.Name)
+			}
+			team = candidate
+		}
+	}
+	if spec.ID != "" && team == nil {
+		return fmt.Errorf("team %q: the team %s was not found", spec.Name, spec.ID)
+	}
+
+	teamID := new(string)
+	var live []*liveMember
+	if team == nil {
+		p.add(&PlanAction{Action: "create", Kind: "team", Target: spec.Name, apply: func() error {
+			p.limiter.Wait()
+			team, _, err := SparkClient.Teams.Post(&ciscospark.TeamRequest{Name: spec.Name})
+			if err == nil {
+				*teamID = team.ID
+			}
+			return err
+		}})
+	} else {
+		*teamID = team.ID
+		if team.Name != spec.Name {
+			p.add(&PlanAction{Action: "rename", Kind: "team", Target: team.Name, Detail: spec.Name, apply: func() error {
+				p.limiter.Wait()
+				_, _, err := SparkClient.Teams.UpdateTeam(team.ID, &ciscospark.UpdateTeamRequest{Name: spec.Name})
+				return err
+			}})
+		}
+
+		memberships, err := ListAllTeamMemberships(team.ID)
+		if err != nil {
+			return err
+		}
+		live = []*liveMember{}
+		for _, membership := range memberships {
+			live = append(live, &liveMember{id: membership.ID, personID: membership.PersonID,
+				email: strings.ToLower(membership.PersonEmail), moderator: membership.IsModerator})
+		}
+	}
+
+	p.planMembers("team", spec.Name, live, wanted, teamMemberOps(p.limiter, teamID))
+	for _, room := range spec.Rooms {
+		if err := p.planRoom(room, teamID, spec.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PlanSpaces returns the actions needed to make the live teams, rooms and memberships match the spec,
+// applied through the limiter
+func PlanSpaces(spec *SpacesSpec, limiter *RateLimiter) ([]*PlanAction, error) {
+	me, response, err := SparkClient.People.GetMe()
+	if verbose {
+		PrintRequestWithoutBody(response.Request)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rooms, err := ListAllRooms(nil)
+	if err != nil {
+		return nil, err
+	}
+	planner := &spacesPlanner{me: me, rooms: rooms, teamRooms: make(map[string][]*SparkRoom), limiter: limiter}
+
+	if len(spec.Teams) > 0 {
+		teams, err := ListAllTeams()
+		if err != nil {
+			return nil, err
+		}
+		for _, team := range spec.Teams {
+			if err := planner.planTeam(team, teams); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	noTeam := new(string)
+	for _, room := range spec.Rooms {
+		if err := planner.planRoom(room, noTeam, ""); err != nil {
+			return nil, err
+		}
+	}
+	return planner.actions, nil
+}
+
+// printPlan prints the actions, as lines followed by a summary, or in the -f/--format format when it is set
+func printPlan(cmd *cobra.Command, actions []*PlanAction) {
+	if cmd.Flags().Changed("format") {
+		PrintResponseFormat(actions)
+		return
+	}
+	if len(actions) == 0 {
+		fmt.Println("No changes, the live state matches the spec.")
+		return
+	}
+	counts := make(map[byte]int)
+	for _, action := range actions {
+		line := action.String()
+		counts[line[0]]++
+		fmt.Println(line)
+	}
+	fmt.Printf("\nPlan: %d to add, %d to change, %d to remove.\n", counts['+'], counts['~'], counts['-'])
+}
+
+// planSpecFile returns the spec file given with --file or as the argument. A YAML file given to -f, the global
+// format flag, is the spec too: the format is reset so the plan is printed as lines.
+func planSpecFile(cmd *cobra.Command, args []string) string {
+	if ext := strings.ToLower(filepath.Ext(format)); ext == ".yaml" || ext == ".yml" {
+		if planFile != "" || len(args) == 1 {
+			log.Fatalf("-f is the output format, %s cannot be used with another spec file", format)
+		}
+		planFile = format
+		format = "json"
+		cmd.Flags().Lookup("format").Changed = false
+	}
+	if planFile != "" {
+		return planFile
+	}
+	if len(args) == 1 {
+		return args[0]
+	}
+	fmt.Println(cmd.Help())
+	os.Exit(-1)
+	return ""
+}
+
+// planSpecHelp documents the spec file, shared by plan and apply
+const planSpecHelp = `The spec is a YAML file describing teams with their rooms, and rooms outside of teams:
+
+  teams:
+    - name: Platform
+      moderators: [alice@example.com]
+      members: [bob@example.com]
+      rooms:
+        - title: Platform Incidents
+          members: [bob@example.com, carol@example.com]
+  rooms:
+    - title: Ops Incidents
+      id: <room ID, needed to rename a room>
+      moderators: [alice@example.com]
+      members: [bob@example.com]
+
+Teams and rooms are found by name, or by id when it is set. People are given by email address, ID or display name.
+The members missing from the spec are removed, except the authenticated user. Teams and rooms are never deleted.`
+
+// planCmd represents the plan command
+var planCmd = &cobra.Command{
+	Use:   "plan [spec.yaml]",
+	Short: "Show the changes needed to match a spec",
+	Long: `Compares the teams, rooms and memberships described by a spec with the live state, and shows the creations,
+title updates, membership additions and removals and moderator changes that go-spark apply would make.
+
+Use --file or an argument to define the spec, for example go-spark plan spaces.yaml.
+-f is the global -f/--format flag: -f json or csv shows the plan in that format, -f spaces.yaml reads the spec.
+
+` + planSpecHelp,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		spec, err := loadSpacesSpec(planSpecFile(cmd, args))
+		if err != nil {
+			log.Fatal(err)
+		}
+		actions, err := PlanSpaces(spec, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printPlan(cmd, actions)
+	},
+}
+
+// applyCmd represents the apply command
+var applyCmd = &cobra.Command{
+	Use:   "apply [spec.yaml]",
+	Short: "Make the live state match a spec",
+	Long: `Shows the plan of a spec, like go-spark plan, and applies it after confirmation.
+
+The actions are applied in order and apply stops at the first error: running it again applies the remaining changes.
+The changes are made at --rate requests per second, retrying when rate limited. Use -y/--yes to not ask for confirmation.
+
+` + planSpecHelp,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		spec, err := loadSpacesSpec(planSpecFile(cmd, args))
+		if err != nil {
+			log.Fatal(err)
+		}
+		actions, err := PlanSpaces(spec, NewRateLimiter(applyRate))
+		if err != nil {
+			log.Fatal(err)
+		}
+		printPlan(cmd, actions)
+		if len(actions) == 0 {
+			return
+		}
+		if !applyYes && !Confirm(fmt.Sprintf("Apply the %d changes?", len(actions))) {
+			fmt.Fprintln(os.Stderr, "Aborted")
+			os.Exit(-1)
+		}
+
+		for i, action := range actions {
+			if err := action.apply(); err != nil {
+				log.Fatalf("%s: %v (%d of %d changes applied)", action, err, i, len(actions))
+			}
+			fmt.Fprintf(os.Stderr, "Applied: %s\n", action)
+		}
+		fmt.Fprintf(os.Stderr, "Applied %d changes\n", len(actions))
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(planCmd)
+	RootCmd.AddCommand(applyCmd)
+
+	planCmd.Flags().StringVar(&planFile, "file", "", "The spec file.")
+
+	applyCmd.Flags().StringVar(&planFile, "file", "", "The spec file.")
+	applyCmd.Flags().BoolVarP(&applyYes, "yes", "y", false, "Do not ask for confirmation.")
+	applyCmd.Flags().Float64Var(&applyRate, "rate", 5, "The maximum number of requests per second.")
+}
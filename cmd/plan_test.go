@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jbogarin/go-cisco-spark/ciscospark"
+)
+
+func TestPlanMembers(t *testing.T) {
+	me := &ciscospark.Person{ID: "me", Emails: []string{"me@example.com"}}
+	live := []*liveMember{
+		{id: "m-me", personID: "me", email: "me@example.com", moderator: true},
+		{id: "m-alice", personID: "alice", email: "alice@example.com"},
+		{id: "m-bob", personID: "bob", email: "bob@example.com", moderator: true},
+		{id: "m-carol", personID: "carol", email: "carol@example.com"},
+	}
+
+	tests := []struct {
+		name    string
+		live    []*liveMember
+		wanted  map[string]bool
+		actions []string
+	}{
+		{
+			name:    "in sync",
+			live:    live,
+			wanted:  map[string]bool{"alice@example.com": false, "bob@example.com": true, "carol@example.com": false},
+			actions: nil,
+		},
+		{
+			name:   "add, update and remove",
+			live:   live,
+			wanted: map[string]bool{"alice@example.com": true, "bob@example.com": true, "dave@example.com": false},
+			actions: []string{
+				`~ make alice@example.com a moderator of room "Room"`,
+				`+ add dave@example.com to room "Room"`,
+				`- remove carol@example.com from room "Room"`,
+			},
+		},
+		{
+			name:   "authenticated user kept",
+			live:   live,
+			wanted: map[string]bool{},
+			actions: []string{
+				`- remove alice@example.com from room "Room"`,
+				`- remove bob@example.com from room "Room"`,
+				`- remove carol@example.com from room "Room"`,
+			},
+		},
+		{
+			name:   "new room",
+			live:   nil,
+			wanted: map[string]bool{"me@example.com": true, "alice@example.com": true},
+			actions: []string{
+				`+ add alice@example.com to room "Room" as moderator`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			planner := &spacesPlanner{me: me}
+			planner.planMembers("room", "Room", test.live, test.wanted, &memberOps{})
+			var actions []string
+			for _, action := range planner.actions {
+				actions = append(actions, action.String())
+			}
+			if !reflect.DeepEqual(actions, test.actions) {
+				t.Errorf("got actions %q, want %q", actions, test.actions)
+			}
+		})
+	}
+}
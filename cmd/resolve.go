@@ -0,0 +1,364 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jbogarin/go-cisco-spark/ciscospark"
+	"github.com/spf13/cobra"
+)
+
+// resolveCacheTTL is how long the rooms and people cached by the resolver are used
+const resolveCacheTTL = time.Hour
+
+// roomsCache is the list of rooms cached by the resolver
+type roomsCache struct {
+	Updated time.Time         `json:"updated"`
+	Rooms   []*roomsCacheItem `json:"rooms"`
+}
+
+// roomsCacheItem is a room cached by the resolver
+type roomsCacheItem struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// peopleCache is the people resolved by the resolver, by lowercase email address, ID or display name
+type peopleCache struct {
+	Updated time.Time                     `json:"updated"`
+	People  map[string]*ciscospark.Person `json:"people"`
+}
+
+// resolvedPeople caches the people resolved by this process, including me
+var resolvedPeople = struct {
+	sync.Mutex
+	people map[string]*ciscospark.Person
+}{people: make(map[string]*ciscospark.Person)}
+
+// IsSparkID returns whether the value is a Spark ID rather than a name
+func IsSparkID(value string) bool {
+	_, err := DecodeSparkID(value)
+	return err == nil
+}
+
+// resolveCachePath returns a cache file of the resolver, in a user cache directory of the token,
+// so the names are not resolved to the rooms and people of another account
+func resolveCachePath(name string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	account := sha256.Sum256([]byte(SparkClient.Authorization))
+	dir = filepath.Join(dir, "go-spark", hex.EncodeToString(account[:8]))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// readRoomsCache returns the cached rooms, or nil when the cache is missing or expired
+func readRoomsCache() []*roomsCacheItem {
+	path, err := resolveCachePath("rooms.json")
+	if err != nil {
+		return nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	cache := new(roomsCache)
+	if err := json.Unmarshal(content, cache); err != nil || time.Since(cache.Updated) > resolveCacheTTL {
+		return nil
+	}
+	return cache.Rooms
+}
+
+// listRoomsForResolver lists every room and caches their IDs and titles
+func listRoomsForResolver() ([]*roomsCacheItem, error) {
+	rooms, err := ListAllRooms(nil)
+	if err != nil {
+		return nil, err
+	}
+	cache := &roomsCache{Updated: time.Now()}
+	for _, room := range rooms {
+		cache.Rooms = append(cache.Rooms, &roomsCacheItem{ID: room.ID, Title: room.Title})
+	}
+
+	if path, err := resolveCachePath("rooms.json"); err == nil {
+		if content, err := json.Marshal(cache); err == nil {
+			ioutil.WriteFile(path, content, 0600)
+		}
+	}
+	return cache.Rooms, nil
+}
+
+// matchRoomName returns the rooms with the exact title, or else with the title in another case, or else containing the name
+func matchRoomName(rooms []*roomsCacheItem, name string) []*roomsCacheItem {
+	matchers := []func(title string) bool{
+		func(title string) bool { return title == name },
+		func(title string) bool { return strings.EqualFold(title, name) },
+		func(title string) bool { return strings.Contains(strings.ToLower(title), strings.ToLower(name)) },
+	}
+	for _, matches := range matchers {
+		var found []*roomsCacheItem
+		for _, room := range rooms {
+			if matches(room.Title) {
+				found = append(found, room)
+			}
+		}
+		if len(found) > 0 {
+			return found
+		}
+	}
+	return nil
+}
+
+// ResolveRoomID returns the ID of a room given by ID, UUID, client link or name.
+// The rooms are cached for an hour, and listed again unless the exact title is found in the cache,
+// so a room created since with the exact title wins over the other matches.
+func ResolveRoomID(value string) (string, error) {
+	room, err := resolveRoom(value)
+	if err != nil {
+		return "", err
+	}
+	return room.ID, nil
+}
+
+// resolveRoom returns the room given by ID, UUID, client link or name, with its title when it was given by name
+func resolveRoom(value string) (*roomsCacheItem, error) {
+	value, err := NormalizeSparkID(value, "ROOM")
+	if err != nil {
+		return nil, err
+	}
+	if value == "" || IsSparkID(value) {
+		return &roomsCacheItem{ID: value}, nil
+	}
+
+	found := matchRoomName(readRoomsCache(), value)
+	if len(found) == 0 || found[0].Title != value {
+		rooms, err := listRoomsForResolver()
+		if err != nil {
+			return nil, err
+		}
+		found = matchRoomName(rooms, value)
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("no room found matching %q", value)
+	case 1:
+		return found[0], nil
+	}
+	candidates := make([]string, len(found))
+	for i, room := range found {
+		candidates[i] = fmt.Sprintf("  %s  %s", room.ID, room.Title)
+	}
+	return nil, fmt.Errorf("%d rooms match %q, use one of these IDs:\n%s", len(found), value, strings.Join(candidates, "\n"))
+}
+
+// resolveRoomFlags returns a PreRun resolving the room names given to the flags into room IDs
+func resolveRoomFlags(names ...string) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		for _, name := range names {
+			flag := cmd.Flags().Lookup(name)
+			if flag == nil || flag.Value.String() == "" {
+				continue
+			}
+			id, err := ResolveRoomID(flag.Value.String())
+			if err != nil {
+				log.Fatal(err)
+			}
+			flag.Value.Set(id)
+		}
+	}
+}
+
+// resolveRoomFlagsConfirmed returns a PreRun resolving the room names given to the flags like resolveRoomFlags,
+// for the commands deleting rooms, messages or memberships. A name only matching part of a room title is
+// confirmed first, showing the title, and refused when yes is set as nobody is there to confirm it.
+func resolveRoomFlagsConfirmed(yes *bool, names ...string) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		for _, name := range names {
+			flag := cmd.Flags().Lookup(name)
+			if flag == nil || flag.Value.String() == "" {
+				continue
+			}
+			value := flag.Value.String()
+			room, err := resolveRoom(value)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if room.Title != "" && !strings.EqualFold(room.Title, value) {
+				if yes != nil && *yes {
+					log.Fatalf("%q only matches part of the title of the room %q, use the full title or the room ID", value, room.Title)
+				}
+				if !Confirm(fmt.Sprintf("%q matches the room %q, continue?", value, room.Title)) {
+					fmt.Fprintln(os.Stderr, "Aborted")
+					os.Exit(-1)
+				}
+			}
+			flag.Value.Set(room.ID)
+		}
+	}
+}
+
+// readPeopleCache returns the cached people, or an empty cache when it is missing or expired
+func readPeopleCache() *peopleCache {
+	cache := &peopleCache{Updated: time.Now(), People: make(map[string]*ciscospark.Person)}
+	path, err := resolveCachePath("people.json")
+	if err != nil {
+		return cache
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	cached := new(peopleCache)
+	if err := json.Unmarshal(content, cached); err != nil || time.Since(cached.Updated) > resolveCacheTTL || cached.People == nil {
+		return cache
+	}
+	return cached
+}
+
+// writePeopleCache saves the people cache, errors are ignored as the cache is only an optimization
+func writePeopleCache(cache *peopleCache) {
+	path, err := resolveCachePath("people.json")
+	if err != nil {
+		return
+	}
+	if content, err := json.Marshal(cache); err == nil {
+		ioutil.WriteFile(path, content, 0600)
+	}
+}
+
+// findPeopleByName looks up the people by display name, keeping the exact matches when there are several people
+func findPeopleByName(name string) ([]*ciscospark.Person, error) {
+	people, response, err := SparkClient.People.Get(&ciscospark.GetPeopleQueryParams{DisplayName: name, Max: 100})
+	if verbose && response != nil {
+		PrintRequestWithoutBody(response.Request)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(people) <= 1 {
+		return people, nil
+	}
+
+	var exact []*ciscospark.Person
+	for _, person := range people {
+		if strings.EqualFold(person.DisplayName, name) {
+			exact = append(exact, person)
+		}
+	}
+	if len(exact) > 0 {
+		return exact, nil
+	}
+	return people, nil
+}
+
+// ResolvePerson returns a person given by email address, ID, display name, or me for the authenticated user.
+// The people are cached for an hour.
+func ResolvePerson(value string) (*ciscospark.Person, error) {
+	key := strings.ToLower(strings.TrimSpace(value))
+	resolvedPeople.Lock()
+	person, ok := resolvedPeople.people[key]
+	resolvedPeople.Unlock()
+	if ok {
+		return person, nil
+	}
+
+	// me depends on the token, so it is not saved in the cache file
+	cache := readPeopleCache()
+	if person, ok := cache.People[key]; ok && key != "me" {
+		return person, nil
+	}
+
+	var err error
+	switch {
+	case key == "me":
+		person, _, err = SparkClient.People.GetMe()
+	case strings.Contains(key, "@"):
+		person, err = findPersonByEmail(value)
+	case IsSparkID(value):
+		person, _, err = SparkClient.People.GetPerson(value)
+	default:
+		var people []*ciscospark.Person
+		people, err = findPeopleByName(value)
+		if err == nil && len(people) == 0 {
+			err = fmt.Errorf("no person found matching %q", value)
+		}
+		if err == nil && len(people) > 1 {
+			candidates := make([]string, len(people))
+			for i, candidate := range people {
+				candidates[i] = fmt.Sprintf("  %s  %s  %s", candidate.ID, candidate.DisplayName, strings.Join(candidate.Emails, ", "))
+			}
+			err = fmt.Errorf("%d people match %q, use one of these emails or IDs:\n%s", len(people), value, strings.Join(candidates, "\n"))
+		}
+		if err == nil {
+			person = people[0]
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resolvedPeople.Lock()
+	resolvedPeople.people[key] = person
+	resolvedPeople.Unlock()
+	if key != "me" {
+		cache.People[key] = person
+		writePeopleCache(cache)
+	}
+	return person, nil
+}
+
+// PersonEmail returns the primary email address of a person
+func PersonEmail(person *ciscospark.Person) string {
+	if len(person.Emails) == 0 {
+		return ""
+	}
+	return person.Emails[0]
+}
+
+// resolvePersonFlags returns a PreRun resolving the people given to the flags into person IDs
+func resolvePersonFlags(names ...string) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		for _, name := range names {
+			flag := cmd.Flags().Lookup(name)
+			if flag == nil || flag.Value.String() == "" {
+				continue
+			}
+			person, err := ResolvePerson(flag.Value.String())
+			if err != nil {
+				log.Fatal(err)
+			}
+			flag.Value.Set(person.ID)
+		}
+	}
+}
+
+// resolvePersonEmailFlags returns a PreRun resolving the people given to the flags into email addresses
+func resolvePersonEmailFlags(names ...string) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		for _, name := range names {
+			flag := cmd.Flags().Lookup(name)
+			if flag == nil || flag.Value.String() == "" {
+				continue
+			}
+			person, err := ResolvePerson(flag.Value.String())
+			if err != nil {
+				log.Fatal(err)
+			}
+			flag.Value.Set(PersonEmail(person))
+		}
+	}
+}
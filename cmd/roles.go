@@ -64,4 +64,6 @@ func init() {
 	rolesCmd.AddCommand(rolesGetCmd)
 
 	rolesGetCmd.Flags().StringVarP(&roleID, "id", "i", "", "The role ID")
+
+	setIDFlagType(rolesGetCmd, "id", "ROLE")
 }
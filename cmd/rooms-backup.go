@@ -0,0 +1,466 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jbogarin/go-cisco-spark/ciscospark"
+	"github.com/spf13/cobra"
+)
+
+var backupRoomID, backupOut string
+var restoreFrom, restoreTitle, restoreTeamID string
+var restoreRate float64
+
+// backupVersion is the version of the backup archive layout
+const backupVersion = 1
+
+// RoomBackup is the metadata of a room backup, saved as room.json in the archive
+type RoomBackup struct {
+	Version     int        `json:"version"`
+	Created     time.Time  `json:"created"`
+	Room        *SparkRoom `json:"room"`
+	Messages    int        `json:"messages"`
+	Memberships int        `json:"memberships"`
+}
+
+// restoreState records the progress of a restore, to resume it when interrupted
+type restoreState struct {
+	RoomID        string            `json:"roomId"`
+	MembersDone   bool              `json:"membersDone"`
+	Replayed      int               `json:"replayed"`
+	ReplayedParts int               `json:"replayedParts,omitempty"`
+	RestoredIDs   map[string]string `json:"restoredIds"`
+	FailedMembers []string          `json:"failedMembers,omitempty"`
+}
+
+// addTarFile adds a file to the archive, with the content of the reader
+func addTarFile(archive *tar.Writer, name string, size int64, content io.Reader) error {
+	header := &tar.Header{Name: name, Mode: 0600, Size: size, ModTime: time.Now()}
+	if err := archive.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := io.Copy(archive, content)
+	return err
+}
+
+// addTarJSON adds a JSON file to the archive
+func addTarJSON(archive *tar.Writer, name string, value interface{}) error {
+	content, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	return addTarFile(archive, name, int64(len(content)), bytes.NewReader(content))
+}
+
+// writeRoomBackup writes the archive of a room: room.json, memberships.json, messages.jsonl and the files
+func writeRoomBackup(out string, backup *RoomBackup, memberships []*SparkMembership, messages []*ExportedMessage) error {
+	file, err := os.Create(out + ".part")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	compressed := gzip.NewWriter(file)
+	archive := tar.NewWriter(compressed)
+
+	if err := addTarJSON(archive, "room.json", backup); err != nil {
+		return err
+	}
+	if err := addTarJSON(archive, "memberships.json", memberships); err != nil {
+		return err
+	}
+
+	var lines bytes.Buffer
+	encoder := json.NewEncoder(&lines)
+	var localFiles []string
+	for _, message := range messages {
+		archived := *message
+		archived.LocalFiles = nil
+		for _, localFile := range message.LocalFiles {
+			archived.LocalFiles = append(archived.LocalFiles, path.Join("files", filepath.Base(localFile)))
+			localFiles = append(localFiles, localFile)
+		}
+		if err := encoder.Encode(&archived); err != nil {
+			return err
+		}
+	}
+	if err := addTarFile(archive, "messages.jsonl", int64(lines.Len()), &lines); err != nil {
+		return err
+	}
+
+	for _, localFile := range localFiles {
+		info, err := os.Stat(localFile)
+		if err != nil {
+			return err
+		}
+		content, err := os.Open(localFile)
+		if err != nil {
+			return err
+		}
+		err = addTarFile(archive, path.Join("files", filepath.Base(localFile)), info.Size(), content)
+		content.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	if err := compressed.Close(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(out+".part", out)
+}
+
+// readRoomBackup extracts the files of a backup archive to dir and returns its metadata, memberships and messages
+func readRoomBackup(from, dir string) (*RoomBackup, []*SparkMembership, []*ExportedMessage, error) {
+	file, err := os.Open(from)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer file.Close()
+	compressed, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%s: %v", from, err)
+	}
+	archive := tar.NewReader(compressed)
+
+	backup := new(RoomBackup)
+	var memberships []*SparkMembership
+	var messages []*ExportedMessage
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%s: %v", from, err)
+		}
+
+		switch name := path.Clean(header.Name); {
+		case name == "room.json":
+			err = json.NewDecoder(archive).Decode(backup)
+		case name == "memberships.json":
+			err = json.NewDecoder(archive).Decode(&memberships)
+		case name == "messages.jsonl":
+			decoder := json.NewDecoder(archive)
+			for decoder.More() {
+				message := new(ExportedMessage)
+				if err = decoder.Decode(message); err != nil {
+					break
+				}
+				messages = append(messages, message)
+			}
+		case strings.HasPrefix(name, "files/") && header.Typeflag == tar.TypeReg:
+			// only the base name is used so the archive cannot write outside of dir
+			var out *os.File
+			if out, err = os.Create(filepath.Join(dir, path.Base(name))); err == nil {
+				_, err = io.Copy(out, archive)
+				out.Close()
+			}
+		}
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%s: %s: %v", from, header.Name, err)
+		}
+	}
+	if backup.Room == nil {
+		return nil, nil, nil, fmt.Errorf("%s is not a room backup", from)
+	}
+	return backup, memberships, messages, nil
+}
+
+// readRestoreState reads the progress of a restore, it returns an empty state when there is none
+func readRestoreState(statePath string) *restoreState {
+	state := &restoreState{RestoredIDs: make(map[string]string)}
+	content, err := ioutil.ReadFile(statePath)
+	if err != nil {
+		return state
+	}
+	if err := json.Unmarshal(content, state); err != nil || state.RestoredIDs == nil {
+		return &restoreState{RestoredIDs: make(map[string]string)}
+	}
+	return state
+}
+
+// writeRestoreState atomically replaces the progress of a restore
+func writeRestoreState(statePath string, state *restoreState) error {
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(statePath+".tmp", content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(statePath+".tmp", statePath)
+}
+
+// restoredFileName removes the prefix added to the downloaded files
+func restoredFileName(localFile string) string {
+	name := filepath.Base(localFile)
+	if i := strings.Index(name, "-"); i == 8 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// replayMessage posts a message of the backup to the restored room, attributed to its sender in the text.
+// A long message is posted in several parts, and its files after the first one as replies: the first done parts and files
+// were posted by an interrupted restore as newID, and progress is called after every part or file posted to save it.
+func replayMessage(limiter *RateLimiter, roomID, parentID string, message *ExportedMessage, filesDir string, done int, newID string, progress func(newID string, done int)) error {
+	created := ""
+	if message.Created != nil {
+		created = " · " + message.Created.UTC().Format("2006-01-02 15:04 UTC")
+	}
+	sender := message.PersonDisplayName
+	if sender == "" {
+		sender = message.PersonEmail
+	}
+	body := message.MarkDown
+	if body == "" {
+		body = message.Text
+	}
+	if body == "" && len(message.LocalFiles) == 0 {
+		body = "_(message without text)_"
+	}
+	header := fmt.Sprintf("**%s**%s", sender, created)
+
+	parts := []string{header}
+	if body != "" {
+		parts = SplitMessage(header+"\n\n"+body, MaxMessageSize)
+	}
+
+	for i, part := range parts {
+		if i < done {
+			continue
+		}
+		request := &SparkMessageRequest{RoomID: roomID, ParentID: parentID, MarkDown: part}
+		var posted *SparkMessage
+		var err error
+		if i == len(parts)-1 && len(message.LocalFiles) > 0 {
+			// the first file is attached to the last part, the other files are posted after it
+			localFile := message.LocalFiles[0]
+			posted, err = PostSparkMessageFileWithRetry(limiter, request, restoredFileName(localFile), filepath.Join(filesDir, filepath.Base(localFile)))
+		} else {
+			posted, err = PostSparkMessageWithRetry(limiter, request)
+		}
+		if err != nil {
+			return err
+		}
+		if newID == "" {
+			newID = posted.ID
+		}
+		progress(newID, i+1)
+	}
+
+	for i, localFile := range message.LocalFiles {
+		if i == 0 || len(parts)+i-1 < done {
+			continue
+		}
+		replyTo := parentID
+		if replyTo == "" {
+			replyTo = newID
+		}
+		request := &SparkMessageRequest{RoomID: roomID, ParentID: replyTo}
+		if _, err := PostSparkMessageFileWithRetry(limiter, request, restoredFileName(localFile), filepath.Join(filesDir, filepath.Base(localFile))); err != nil {
+			return err
+		}
+		progress(newID, len(parts)+i)
+	}
+	return nil
+}
+
+// roomsBackupCmd represents the rooms backup command
+var roomsBackupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Back up a room",
+	Long: `Backs up a room to a tar.gz archive with the room details, the memberships with their moderator flags,
+the whole message history and the files of the messages.
+
+Specify the room with the -i/--id flag and the archive with -o/--out.
+
+The progress is saved next to the archive, an interrupted backup resumes when it is run again.`,
+	PreRun: resolveRoomFlags("id"),
+	Run: func(cmd *cobra.Command, args []string) {
+		if backupRoomID == "" || backupOut == "" {
+			fmt.Println(cmd.Help())
+			os.Exit(-1)
+		}
+
+		room, err := GetSparkRoom(backupRoomID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		memberships, err := ListAllMemberships(backupRoomID)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		workDir := backupOut + ".work"
+		spoolPath := filepath.Join(workDir, "messages.spool")
+		if err := os.MkdirAll(workDir, 0700); err != nil {
+			log.Fatal(err)
+		}
+		messages, err := FetchRoomHistory(backupRoomID, spoolPath, filepath.Join(workDir, "files"))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		backup := &RoomBackup{
+			Version:     backupVersion,
+			Created:     time.Now(),
+			Room:        room,
+			Messages:    len(messages),
+			Memberships: len(memberships),
+		}
+		if err := writeRoomBackup(backupOut, backup, memberships, messages); err != nil {
+			log.Fatal(err)
+		}
+		os.RemoveAll(workDir)
+		fmt.Fprintf(os.Stderr, "Backed up %d messages and %d memberships to %s\n", len(messages), len(memberships), backupOut)
+	},
+}
+
+// roomsRestoreCmd represents the rooms restore command
+var roomsRestoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore a room from a backup",
+	Long: `Creates a room from a backup made with rooms backup, adds the members back with their moderator flags
+and replays the messages, oldest first, with their files.
+
+Messages cannot be posted on behalf of other people: every message starts with the name of its sender
+and the time it was sent. Replies are replayed in their thread.
+
+Use --from to define the archive, --title to define the title of the new room (default is the title of the backup)
+and -T/--team to create it in a team.
+
+The progress is saved next to the archive, an interrupted restore resumes in the same room when it is run again.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if restoreFrom == "" {
+			fmt.Println(cmd.Help())
+			os.Exit(-1)
+		}
+
+		filesDir, err := ioutil.TempDir("", "go-spark-restore")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer os.RemoveAll(filesDir)
+		backup, memberships, messages, err := readRoomBackup(restoreFrom, filesDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		statePath := restoreFrom + ".restore"
+		state := readRestoreState(statePath)
+		saveState := func() {
+			if err := writeRestoreState(statePath, state); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if state.RoomID == "" {
+			roomRequest := &ciscospark.RoomRequest{Title: restoreTitle, TeamID: restoreTeamID}
+			if roomRequest.Title == "" {
+				roomRequest.Title = backup.Room.Title
+			}
+			room, response, err := SparkClient.Rooms.Post(roomRequest)
+			if verbose {
+				PrintRequestWithBody(response.Request, roomRequest)
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+			state.RoomID = room.ID
+			saveState()
+			fmt.Fprintf(os.Stderr, "Created the room %s\n", room.ID)
+		} else {
+			fmt.Fprintf(os.Stderr, "Resuming the restore in the room %s after %d messages\n", state.RoomID, state.Replayed)
+		}
+
+		limiter := NewRateLimiter(restoreRate)
+		if !state.MembersDone {
+			me, _, err := SparkClient.People.GetMe()
+			if err != nil {
+				log.Fatal(err)
+			}
+			for _, membership := range memberships {
+				if membership.PersonID == me.ID || membership.IsMonitor {
+					continue
+				}
+				membershipRequest := &ciscospark.MembershipRequest{
+					RoomID:      state.RoomID,
+					PersonID:    membership.PersonID,
+					IsModerator: membership.IsModerator,
+				}
+				if _, err := PostMembershipWithRetry(limiter, membershipRequest); err != nil {
+					fmt.Fprintf(os.Stderr, "Unable to add %s: %v\n", membership.PersonEmail, err)
+					state.FailedMembers = append(state.FailedMembers, membership.PersonEmail)
+				}
+			}
+			state.MembersDone = true
+			saveState()
+		}
+
+		for i := state.Replayed; i < len(messages); i++ {
+			message := messages[i]
+			parentID := ""
+			if message.ParentID != "" {
+				parentID = state.RestoredIDs[message.ParentID]
+			}
+			err := replayMessage(limiter, state.RoomID, parentID, message, filesDir, state.ReplayedParts, state.RestoredIDs[message.ID], func(newID string, done int) {
+				state.RestoredIDs[message.ID] = newID
+				state.ReplayedParts = done
+				saveState()
+			})
+			if err != nil {
+				log.Fatalf("unable to replay the message %d of %d: %v", i+1, len(messages), err)
+			}
+			state.Replayed = i + 1
+			state.ReplayedParts = 0
+			saveState()
+			fmt.Fprintf(os.Stderr, "Replayed %d of %d messages\r", state.Replayed, len(messages))
+		}
+		fmt.Fprintln(os.Stderr)
+
+		room, err := GetSparkRoom(state.RoomID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(state.FailedMembers) > 0 {
+			fmt.Fprintf(os.Stderr, "Unable to add %d members: %s\n", len(state.FailedMembers), strings.Join(state.FailedMembers, ", "))
+		}
+		os.Remove(statePath)
+		PrintResponseFormat(room)
+	},
+}
+
+func init() {
+	roomsCmd.AddCommand(roomsBackupCmd)
+	roomsCmd.AddCommand(roomsRestoreCmd)
+
+	roomsBackupCmd.Flags().StringVarP(&backupRoomID, "id", "i", "", "The Room, by ID or name")
+	roomsBackupCmd.Flags().StringVarP(&backupOut, "out", "o", "", "The archive, for example room.tar.gz.")
+
+	roomsRestoreCmd.Flags().StringVar(&restoreFrom, "from", "", "The archive made by rooms backup.")
+	roomsRestoreCmd.Flags().StringVar(&restoreTitle, "title", "", "The title of the new room (default is the title of the backup).")
+	roomsRestoreCmd.Flags().StringVarP(&restoreTeamID, "team", "T", "", "Create the room in this team, by ID.")
+	roomsRestoreCmd.Flags().Float64Var(&restoreRate, "rate", 2, "The maximum number of messages posted per second.")
+
+	setIDFlagType(roomsBackupCmd, "id", "ROOM")
+	setIDFlagType(roomsRestoreCmd, "team", "TEAM")
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jbogarin/go-cisco-spark/ciscospark"
+	"github.com/spf13/cobra"
+)
+
+var cloneRoomID, cloneTitle, cloneTeamID, cloneReport string
+var cloneIncludeModerators bool
+var cloneWorkers int
+var cloneRate float64
+
+// CloneResult is the outcome of copying a membership to the cloned room
+type CloneResult struct {
+	PersonEmail       string `json:"personEmail" csv:"personEmail"`
+	PersonDisplayName string `json:"personDisplayName,omitempty" csv:"personDisplayName"`
+	IsModerator       bool   `json:"isModerator" csv:"isModerator"`
+	BulkStatus
+}
+
+// roomsCloneCmd represents the rooms clone command
+var roomsCloneCmd = &cobra.Command{
+	Use:   "clone",
+	Short: "Create a room with the members of another room",
+	Long: `Creates a room and adds every member of the source room to it, reporting the people who could not be added.
+
+Specify the source room with the -i/--id flag and the title of the new room with --title.
+Use -T/--team to create the room in a team and --include-moderators to keep the moderators of the source room.
+
+The members are added by -w/--workers workers, sharing --rate requests per second.`,
+	PreRun: resolveRoomFlags("id"),
+	Run: func(cmd *cobra.Command, args []string) {
+		if cloneRoomID == "" || cloneTitle == "" {
+			fmt.Println(cmd.Help())
+			os.Exit(-1)
+		}
+
+		memberships, err := ListAllMemberships(cloneRoomID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		me, _, err := SparkClient.People.GetMe()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		roomRequest := &ciscospark.RoomRequest{Title: cloneTitle, TeamID: cloneTeamID}
+		room, response, err := SparkClient.Rooms.Post(roomRequest)
+		if verbose {
+			PrintRequestWithBody(response.Request, roomRequest)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(os.Stderr, "Created the room %s (%s)\n", room.Title, room.ID)
+
+		// the authenticated user is already a member of the new room
+		var copied []*SparkMembership
+		for _, membership := range memberships {
+			if membership.PersonID != me.ID && !membership.IsMonitor {
+				copied = append(copied, membership)
+			}
+		}
+
+		limiter := NewRateLimiter(cloneRate)
+		results := make([]*CloneResult, len(copied))
+		failed := RunBulk(len(copied), cloneWorkers, func(index int) (string, *BulkStatus) {
+			membership := copied[index]
+			result := &CloneResult{
+				PersonEmail:       membership.PersonEmail,
+				PersonDisplayName: membership.PersonDisplayName,
+				IsModerator:       cloneIncludeModerators && membership.IsModerator,
+			}
+			results[index] = result
+
+			_, err := PostMembershipWithRetry(limiter, &ciscospark.MembershipRequest{
+				RoomID:      room.ID,
+				PersonID:    membership.PersonID,
+				IsModerator: result.IsModerator,
+			})
+			if err != nil {
+				result.Fail(err)
+			} else {
+				result.Status = "added"
+			}
+			return membership.PersonEmail, &result.BulkStatus
+		})
+		FinishBulk(results, failed, cloneReport)
+	},
+}
+
+func init() {
+	roomsCmd.AddCommand(roomsCloneCmd)
+
+	roomsCloneCmd.Flags().StringVarP(&cloneRoomID, "id", "i", "", "The source Room, by ID or name")
+	roomsCloneCmd.Flags().StringVar(&cloneTitle, "title", "", "The title of the new room.")
+	roomsCloneCmd.Flags().StringVarP(&cloneTeamID, "team", "T", "", "Create the room in this team, by ID.")
+	roomsCloneCmd.Flags().BoolVar(&cloneIncludeModerators, "include-moderators", false, "Make the moderators of the source room moderators of the new room.")
+	roomsCloneCmd.Flags().IntVarP(&cloneWorkers, "workers", "w", 4, "The number of members added concurrently.")
+	roomsCloneCmd.Flags().Float64Var(&cloneRate, "rate", 5, "The maximum number of requests per second.")
+	roomsCloneCmd.Flags().StringVar(&cloneReport, "report", "", "Write the results to this CSV file.")
+
+	setIDFlagType(roomsCloneCmd, "id", "ROOM")
+	setIDFlagType(roomsCloneCmd, "team", "TEAM")
+}
@@ -0,0 +1,483 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jbogarin/go-cisco-spark/ciscospark"
+	"github.com/spf13/cobra"
+)
+
+var exportRoomID, exportOut, exportAttachmentsDir string
+
+// exportPageSize is the number of messages requested on every page of the history
+const exportPageSize = 100
+
+// ExportedMessage is a message of a room history, with the sender display name and the downloaded files
+type ExportedMessage struct {
+	*SparkMessage
+	PersonDisplayName string   `json:"personDisplayName,omitempty"`
+	LocalFiles        []string `json:"localFiles,omitempty"`
+}
+
+// historyCheckpoint records the progress of a history walk, to resume it when interrupted
+type historyCheckpoint struct {
+	RoomID        string `json:"roomId"`
+	BeforeMessage string `json:"beforeMessage,omitempty"`
+	Count         int    `json:"count"`
+	Done          bool   `json:"done"`
+}
+
+// readHistoryCheckpoint reads the checkpoint of a history walk, it returns nil when there is none
+func readHistoryCheckpoint(checkpointPath string) *historyCheckpoint {
+	content, err := ioutil.ReadFile(checkpointPath)
+	if err != nil {
+		return nil
+	}
+	checkpoint := new(historyCheckpoint)
+	if err := json.Unmarshal(content, checkpoint); err != nil {
+		return nil
+	}
+	return checkpoint
+}
+
+// writeHistoryCheckpoint atomically replaces the checkpoint of a history walk
+func writeHistoryCheckpoint(checkpointPath string, checkpoint *historyCheckpoint) error {
+	content, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(checkpointPath+".tmp", content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(checkpointPath+".tmp", checkpointPath)
+}
+
+// FetchRoomHistory walks the whole history of a room, spooling the messages to spoolPath so an interrupted walk can resume.
+// The files are downloaded to attachmentsDir when it is not empty. The messages are returned oldest first.
+func FetchRoomHistory(roomID, spoolPath, attachmentsDir string) ([]*ExportedMessage, error) {
+	checkpointPath := spoolPath + ".checkpoint"
+	checkpoint := readHistoryCheckpoint(checkpointPath)
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if checkpoint == nil || checkpoint.RoomID != roomID {
+		checkpoint = &historyCheckpoint{RoomID: roomID}
+		flags |= os.O_TRUNC
+	} else if !checkpoint.Done {
+		fmt.Fprintf(os.Stderr, "Resuming after %d messages\n", checkpoint.Count)
+	}
+
+	if attachmentsDir != "" {
+		if err := os.MkdirAll(attachmentsDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	spool, err := os.OpenFile(spoolPath, flags, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	for !checkpoint.Done {
+		messages, response, err := ListSparkMessages(&ciscospark.MessageQueryParams{
+			Max:           exportPageSize,
+			RoomID:        roomID,
+			BeforeMessage: checkpoint.BeforeMessage,
+		})
+		if IsRateLimited(response) {
+			time.Sleep(RetryAfter(response, 10*time.Second))
+			continue
+		}
+		if err != nil {
+			spool.Close()
+			return nil, err
+		}
+
+		for _, message := range messages {
+			exported := &ExportedMessage{
+				SparkMessage:      message,
+				PersonDisplayName: PersonDisplayName(message.PersonID, message.PersonEmail),
+			}
+			if attachmentsDir != "" {
+				for _, fileURL := range message.Files {
+					localFile, err := DownloadFile(fileURL, attachmentsDir)
+					if err != nil {
+						fmt.Fprintln(os.Stderr, err)
+						continue
+					}
+					exported.LocalFiles = append(exported.LocalFiles, localFile)
+				}
+			}
+
+			line, err := json.Marshal(exported)
+			if err != nil {
+				spool.Close()
+				return nil, err
+			}
+			if _, err := spool.Write(append(line, '\n')); err != nil {
+				spool.Close()
+				return nil, err
+			}
+		}
+		if err := spool.Sync(); err != nil {
+			spool.Close()
+			return nil, err
+		}
+
+		checkpoint.Count += len(messages)
+		if len(messages) < exportPageSize {
+			checkpoint.Done = true
+		} else {
+			checkpoint.BeforeMessage = messages[len(messages)-1].ID
+		}
+		if err := writeHistoryCheckpoint(checkpointPath, checkpoint); err != nil {
+			spool.Close()
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "Fetched %d messages\r", checkpoint.Count)
+	}
+	spool.Close()
+	fmt.Fprintln(os.Stderr)
+
+	return readHistorySpool(spoolPath)
+}
+
+// readHistorySpool reads the spooled messages, newest first, and returns them oldest first without duplicates
+func readHistorySpool(spoolPath string) ([]*ExportedMessage, error) {
+	spool, err := os.Open(spoolPath)
+	if err != nil {
+		return nil, err
+	}
+	defer spool.Close()
+
+	var messages []*ExportedMessage
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(spool)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		message := new(ExportedMessage)
+		if err := json.Unmarshal(scanner.Bytes(), message); err != nil || message.SparkMessage == nil {
+			// a line may be truncated when the walk was interrupted
+			continue
+		}
+		if seen[message.ID] {
+			continue
+		}
+		seen[message.ID] = true
+		messages = append(messages, message)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+// RemoveRoomHistorySpool removes the spool and the checkpoint of a finished history walk
+func RemoveRoomHistorySpool(spoolPath string) {
+	os.Remove(spoolPath)
+	os.Remove(spoolPath + ".checkpoint")
+}
+
+// ThreadMessages groups the replies under their parent messages, keeping the order of the messages.
+// Replies whose parent is not in the list are returned as top level messages.
+func ThreadMessages(messages []*ExportedMessage) ([]*ExportedMessage, map[string][]*ExportedMessage) {
+	ids := make(map[string]bool)
+	for _, message := range messages {
+		ids[message.ID] = true
+	}
+
+	var roots []*ExportedMessage
+	replies := make(map[string][]*ExportedMessage)
+	for _, message := range messages {
+		if message.ParentID != "" && ids[message.ParentID] {
+			replies[message.ParentID] = append(replies[message.ParentID], message)
+		} else {
+			roots = append(roots, message)
+		}
+	}
+	return roots, replies
+}
+
+// exportFileLinks returns the links to the files of a message, relative to the output directory when downloaded
+func exportFileLinks(message *ExportedMessage, outDir string) []string {
+	if len(message.LocalFiles) == 0 {
+		return message.Files
+	}
+	var links []string
+	for _, localFile := range message.LocalFiles {
+		if relative, err := filepath.Rel(outDir, localFile); err == nil {
+			localFile = relative
+		}
+		links = append(links, filepath.ToSlash(localFile))
+	}
+	return links
+}
+
+// exportTime formats the creation time of a message in local time
+func exportTime(message *ExportedMessage) string {
+	if message.Created == nil {
+		return ""
+	}
+	return message.Created.Local().Format("2006-01-02 15:04")
+}
+
+// writeMarkdownTranscript writes the messages as a markdown transcript, with the replies quoted under their parent
+func writeMarkdownTranscript(w io.Writer, title string, messages []*ExportedMessage, outDir string) {
+	fmt.Fprintf(w, "# %s\n\n", title)
+
+	roots, replies := ThreadMessages(messages)
+	var writeMessage func(message *ExportedMessage, prefix string)
+	writeMessage = func(message *ExportedMessage, prefix string) {
+		body := message.MarkDown
+		if body == "" {
+			body = message.Text
+		}
+
+		fmt.Fprintf(w, "%s**%s** · %s\n%s\n", prefix, message.PersonDisplayName, exportTime(message), prefix)
+		for _, line := range strings.Split(body, "\n") {
+			fmt.Fprintf(w, "%s%s\n", prefix, line)
+		}
+		for _, link := range exportFileLinks(message, outDir) {
+			fmt.Fprintf(w, "%s- [%s](%s)\n", prefix, filepath.Base(link), link)
+		}
+		fmt.Fprintln(w, strings.TrimSpace(prefix))
+
+		for _, reply := range replies[message.ID] {
+			writeMessage(reply, prefix+"> ")
+		}
+	}
+	for _, message := range roots {
+		writeMessage(message, "")
+	}
+}
+
+// htmlTranscriptTemplate is the template of the HTML transcripts
+var htmlTranscriptTemplate = template.Must(template.New("transcript").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 50em; margin: auto; }
+.message { margin: 1em 0; }
+.meta { color: #666; font-size: smaller; }
+.replies { margin-left: 2em; border-left: 3px solid #ddd; padding-left: 1em; }
+img { max-width: 100%; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{define "message"}}<div class="message" id="{{.ID}}">
+<div class="meta"><strong>{{.Name}}</strong> · {{.Time}}</div>
+<div class="body">{{.Body}}</div>
+{{range .Files}}{{if .Image}}<img src="{{.Link}}" alt="{{.Name}}">{{else}}<a href="{{.Link}}">{{.Name}}</a>{{end}}<br>
+{{end}}{{if .Replies}}<div class="replies">{{range .Replies}}{{template "message" .}}{{end}}</div>{{end}}
+</div>
+{{end}}{{range .Messages}}{{template "message" .}}{{end}}
+</body>
+</html>
+`))
+
+// transcriptTagRegexp matches an HTML tag, with its name and attributes
+var transcriptTagRegexp = regexp.MustCompile(`<(/?)([a-zA-Z][a-zA-Z0-9-]*)([^<>]*)>`)
+
+// transcriptHrefRegexp matches the href attribute of a link
+var transcriptHrefRegexp = regexp.MustCompile(`(?i)\bhref\s*=\s*"([^"]*)"`)
+
+// transcriptTags are the tags kept in the HTML transcripts, without their attributes
+var transcriptTags = map[string]bool{
+	"p": true, "br": true, "b": true, "strong": true, "i": true, "em": true, "del": true, "code": true, "pre": true,
+	"ul": true, "ol": true, "li": true, "blockquote": true, "h1": true, "h2": true, "h3": true, "hr": true,
+}
+
+// sanitizeMessageHTML keeps the formatting tags of a message HTML and the http, https and mailto links,
+// every other tag is dropped and the text is escaped, so no markup of a message runs in the transcript
+func sanitizeMessageHTML(raw string) template.HTML {
+	var sanitized strings.Builder
+	last := 0
+	for _, match := range transcriptTagRegexp.FindAllStringSubmatchIndex(raw, -1) {
+		sanitized.WriteString(template.HTMLEscapeString(html.UnescapeString(raw[last:match[0]])))
+		last = match[1]
+
+		closing := raw[match[2]:match[3]] == "/"
+		name := strings.ToLower(raw[match[4]:match[5]])
+		switch {
+		case transcriptTags[name] && closing:
+			sanitized.WriteString("</" + name + ">")
+		case transcriptTags[name]:
+			sanitized.WriteString("<" + name + ">")
+		case name == "a" && closing:
+			sanitized.WriteString("</a>")
+		case name == "a":
+			href := ""
+			if hrefMatch := transcriptHrefRegexp.FindStringSubmatch(raw[match[6]:match[7]]); hrefMatch != nil {
+				href = html.UnescapeString(hrefMatch[1])
+			}
+			lower := strings.ToLower(href)
+			if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") && !strings.HasPrefix(lower, "mailto:") {
+				href = ""
+			}
+			sanitized.WriteString(`<a href="` + template.HTMLEscapeString(href) + `">`)
+		}
+	}
+	sanitized.WriteString(template.HTMLEscapeString(html.UnescapeString(raw[last:])))
+	return template.HTML(sanitized.String())
+}
+
+// htmlTranscriptFile is a file of a message in the HTML transcripts
+type htmlTranscriptFile struct {
+	Name, Link string
+	Image      bool
+}
+
+// htmlTranscriptMessage is a message in the HTML transcripts
+type htmlTranscriptMessage struct {
+	ID, Name, Time string
+	Body           template.HTML
+	Files          []htmlTranscriptFile
+	Replies        []*htmlTranscriptMessage
+}
+
+// writeHTMLTranscript writes the messages as an HTML transcript, with the replies indented under their parent
+func writeHTMLTranscript(w io.Writer, title string, messages []*ExportedMessage, outDir string) error {
+	roots, replies := ThreadMessages(messages)
+
+	var convert func(message *ExportedMessage) *htmlTranscriptMessage
+	convert = func(message *ExportedMessage) *htmlTranscriptMessage {
+		body := sanitizeMessageHTML(message.HTML)
+		if body == "" {
+			body = template.HTML(strings.Replace(template.HTMLEscapeString(message.Text), "\n", "<br>", -1))
+		}
+
+		converted := &htmlTranscriptMessage{
+			ID:   message.ID,
+			Name: message.PersonDisplayName,
+			Time: exportTime(message),
+			Body: body,
+		}
+		for _, link := range exportFileLinks(message, outDir) {
+			extension := strings.ToLower(filepath.Ext(link))
+			converted.Files = append(converted.Files, htmlTranscriptFile{
+				Name:  filepath.Base(link),
+				Link:  link,
+				Image: extension == ".png" || extension == ".jpg" || extension == ".jpeg" || extension == ".gif",
+			})
+		}
+		for _, reply := range replies[message.ID] {
+			converted.Replies = append(converted.Replies, convert(reply))
+		}
+		return converted
+	}
+
+	var converted []*htmlTranscriptMessage
+	for _, message := range roots {
+		converted = append(converted, convert(message))
+	}
+
+	return htmlTranscriptTemplate.Execute(w, struct {
+		Title    string
+		Messages []*htmlTranscriptMessage
+	}{title, converted})
+}
+
+// roomsExportCmd represents the rooms export command
+var roomsExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the history of a room",
+	Long: `Exports the whole message history of a room, oldest first, with the sender display names.
+
+Specify the room ID with the -i/--id flag and the output file with -o/--out.
+
+Use -f/--format to define the format: jsonl (the default), markdown or html. Replies are kept under their parent message.
+Use -a/--attachments to download the files of the messages to a directory and link them from the transcript.
+
+The progress is saved next to the output file, an interrupted export resumes when it is run again.`,
+	PreRun: resolveRoomFlags("id"),
+	Run: func(cmd *cobra.Command, args []string) {
+		if exportRoomID == "" || exportOut == "" {
+			fmt.Println(cmd.Help())
+			os.Exit(-1)
+		}
+
+		exportFormat := format
+		if !cmd.Flags().Changed("format") || exportFormat == "json" {
+			exportFormat = "jsonl"
+		}
+		if exportFormat == "md" {
+			exportFormat = "markdown"
+		}
+		if exportFormat != "jsonl" && exportFormat != "markdown" && exportFormat != "html" {
+			log.Fatalf("unsupported export format %s, use jsonl, markdown or html", exportFormat)
+		}
+
+		room, response, err := SparkClient.Rooms.GetRoom(exportRoomID)
+		if verbose {
+			PrintRequestWithoutBody(response.Request)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		spoolPath := exportOut + ".part"
+		messages, err := FetchRoomHistory(exportRoomID, spoolPath, exportAttachmentsDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		out, err := os.Create(exportOut)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer out.Close()
+		writer := bufio.NewWriter(out)
+
+		outDir := filepath.Dir(exportOut)
+		switch exportFormat {
+		case "markdown":
+			writeMarkdownTranscript(writer, room.Title, messages, outDir)
+		case "html":
+			err = writeHTMLTranscript(writer, room.Title, messages, outDir)
+		default:
+			encoder := json.NewEncoder(writer)
+			for _, message := range messages {
+				if err = encoder.Encode(message); err != nil {
+					break
+				}
+			}
+		}
+		if err == nil {
+			err = writer.Flush()
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		RemoveRoomHistorySpool(spoolPath)
+		fmt.Fprintf(os.Stderr, "Exported %d messages to %s\n", len(messages), exportOut)
+	},
+}
+
+func init() {
+	roomsCmd.AddCommand(roomsExportCmd)
+
+	roomsExportCmd.Flags().StringVarP(&exportRoomID, "id", "i", "", "The Room, by ID or name")
+	roomsExportCmd.Flags().StringVarP(&exportOut, "out", "o", "", "The output file.")
+	roomsExportCmd.Flags().StringVarP(&exportAttachmentsDir, "attachments", "a", "", "Download the files of the messages to this directory.")
+
+	setIDFlagType(roomsExportCmd, "id", "ROOM")
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jbogarin/go-cisco-spark/ciscospark"
+	"github.com/spf13/cobra"
+)
+
+var leaveRoomID, leaveRoomName, leaveFilter string
+var leaveRate float64
+var leaveDryRun, leaveYes bool
+
+// LeaveResult is the outcome of leaving a room
+type LeaveResult struct {
+	RoomID       string `json:"roomId" csv:"roomId"`
+	RoomTitle    string `json:"roomTitle" csv:"roomTitle"`
+	MembershipID string `json:"membershipId,omitempty" csv:"membershipId"`
+	BulkStatus
+}
+
+// FindMembership returns the membership of a person in a room, through the rate limiter and retrying when rate limited
+func FindMembership(limiter *RateLimiter, roomID, personID string) (*ciscospark.Membership, error) {
+	var memberships []*ciscospark.Membership
+	for {
+		limiter.Wait()
+		var response *ciscospark.Response
+		var err error
+		memberships, response, err = SparkClient.Memberships.Get(&ciscospark.MembershipQueryParams{RoomID: roomID, PersonID: personID})
+		if IsRateLimited(response) {
+			time.Sleep(RetryAfter(response, 10*time.Second))
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+	if len(memberships) == 0 {
+		return nil, fmt.Errorf("membership not found")
+	}
+	return memberships[0], nil
+}
+
+// leaveRooms returns the rooms selected with --id, --name or --filter
+func leaveRooms() ([]*SparkRoom, error) {
+	if leaveRoomID != "" && leaveFilter != "" {
+		return nil, fmt.Errorf("use either -i/--id, -n/--name or --filter")
+	}
+	if leaveRoomID != "" {
+		room, err := GetSparkRoom(leaveRoomID)
+		if err != nil {
+			return nil, err
+		}
+		return []*SparkRoom{room}, nil
+	}
+
+	filter, err := ParseRoomFilter(leaveFilter)
+	if err != nil {
+		return nil, err
+	}
+	rooms, err := ListAllRooms(nil)
+	if err != nil {
+		return nil, err
+	}
+	return FilterSparkRooms(rooms, filter), nil
+}
+
+// roomsLeaveCmd represents the rooms leave command
+var roomsLeaveCmd = &cobra.Command{
+	Use:   "leave",
+	Short: "Leave rooms",
+	Long: `Removes the authenticated user from rooms, by deleting their membership.
+
+Specify the room with the -i/--id flag, an ID or a name, or with the -n/--name flag,
+a name only matching part of the room title is confirmed first and refused with -y/--yes,
+or leave every room matching --filter, for example 'title =~ "test-" and type == group'.
+Use --dry-run to only show the rooms that would be left. The rooms are left at --rate requests per second,
+the 1:1 direct rooms cannot be left and are skipped.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if leaveRoomID != "" && leaveRoomName != "" {
+			log.Fatal("use either -i/--id or -n/--name")
+		}
+		if leaveRoomID == "" {
+			leaveRoomID = leaveRoomName
+		}
+		resolveRoomFlagsConfirmed(&leaveYes, "id")(cmd, args)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if leaveRoomID == "" && leaveFilter == "" {
+			fmt.Println(cmd.Help())
+			os.Exit(-1)
+		}
+
+		rooms, err := leaveRooms()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(rooms) == 0 {
+			log.Fatal("no rooms selected")
+		}
+		me, _, err := SparkClient.People.GetMe()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if !leaveDryRun && !leaveYes {
+			question := fmt.Sprintf("Leave %d rooms?", len(rooms))
+			if len(rooms) == 1 {
+				question = fmt.Sprintf("Leave %s?", rooms[0].Title)
+			}
+			if !Confirm(question) {
+				fmt.Fprintln(os.Stderr, "Aborted")
+				os.Exit(-1)
+			}
+		}
+
+		limiter := NewRateLimiter(leaveRate)
+		results := make([]*LeaveResult, len(rooms))
+		failed := RunBulk(len(rooms), 1, func(index int) (string, *BulkStatus) {
+			room := rooms[index]
+			result := &LeaveResult{RoomID: room.ID, RoomTitle: room.Title}
+			results[index] = result
+			if room.Type == "direct" {
+				result.Status = "skipped"
+				result.Error = "direct rooms cannot be left"
+				return room.Title, &result.BulkStatus
+			}
+
+			membership, err := FindMembership(limiter, room.ID, me.ID)
+			if err == nil {
+				result.MembershipID = membership.ID
+				if leaveDryRun {
+					result.Status = "planned"
+					return room.Title, &result.BulkStatus
+				}
+				err = DeleteMembershipWithRetry(limiter, membership.ID)
+			}
+			if err != nil {
+				result.Fail(err)
+			} else {
+				result.Status = "left"
+			}
+			return room.Title, &result.BulkStatus
+		})
+		FinishBulk(results, failed, "")
+	},
+}
+
+func init() {
+	roomsCmd.AddCommand(roomsLeaveCmd)
+
+	roomsLeaveCmd.Flags().StringVarP(&leaveRoomID, "id", "i", "", "Room ID or name.")
+	roomsLeaveCmd.Flags().StringVarP(&leaveRoomName, "name", "n", "", "Room name.")
+	roomsLeaveCmd.Flags().StringVar(&leaveFilter, "filter", "", "Leave the rooms matching this filter, for example 'title =~ \"test-\"'.")
+	roomsLeaveCmd.Flags().Float64Var(&leaveRate, "rate", 5, "The maximum number of requests per second.")
+	roomsLeaveCmd.Flags().BoolVar(&leaveDryRun, "dry-run", false, "Only show the rooms that would be left.")
+	roomsLeaveCmd.Flags().BoolVarP(&leaveYes, "yes", "y", false, "Do not ask for confirmation.")
+
+	setIDFlagType(roomsLeaveCmd, "id", "ROOM")
+}
@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var staleInactiveFor, cleanupInactiveFor, cleanupAction, cleanupReport string
+var staleWorkers, cleanupWorkers int
+var staleRate, cleanupRate float64
+var cleanupDryRun, cleanupYes bool
+
+// StaleRoom is a room without activity for a while
+type StaleRoom struct {
+	ID           string     `json:"id" csv:"id"`
+	Title        string     `json:"title" csv:"title"`
+	Type         string     `json:"type" csv:"type"`
+	TeamID       string     `json:"teamId,omitempty" csv:"teamId"`
+	LastActivity *time.Time `json:"lastActivity,omitempty" csv:"lastActivity"`
+	InactiveDays int        `json:"inactiveDays" csv:"inactiveDays"`
+	Members      int        `json:"members" csv:"members"`
+	IsModerator  bool       `json:"isModerator" csv:"isModerator"`
+	MembershipID string     `json:"-" csv:"-"`
+	Error        string     `json:"error,omitempty" csv:"error"`
+}
+
+// CleanupResult is the outcome of leaving or deleting a stale room
+type CleanupResult struct {
+	ID           string     `json:"id" csv:"id"`
+	Title        string     `json:"title" csv:"title"`
+	Type         string     `json:"type" csv:"type"`
+	LastActivity *time.Time `json:"lastActivity,omitempty" csv:"lastActivity"`
+	InactiveDays int        `json:"inactiveDays" csv:"inactiveDays"`
+	Action       string     `json:"action" csv:"action"`
+	BulkStatus
+}
+
+// lastActivity returns the last activity of a room, or its creation date when it never had any
+func lastActivity(room *SparkRoom) *time.Time {
+	if room.LastActivity != nil {
+		return room.LastActivity
+	}
+	return room.Created
+}
+
+// ListStaleRooms lists the rooms without activity for inactiveFor, from the least recently active,
+// with their number of members and the membership of the authenticated user, collected by workers through the limiter
+func ListStaleRooms(inactiveFor time.Duration, workers int, limiter *RateLimiter) ([]*StaleRoom, error) {
+	rooms, err := ListAllRooms(nil)
+	if err != nil {
+		return nil, err
+	}
+	me, _, err := SparkClient.People.GetMe()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var stale []*StaleRoom
+	for _, room := range rooms {
+		last := lastActivity(room)
+		if last == nil || now.Sub(*last) < inactiveFor {
+			continue
+		}
+		stale = append(stale, &StaleRoom{
+			ID:           room.ID,
+			Title:        room.Title,
+			Type:         room.Type,
+			TeamID:       room.TeamID,
+			LastActivity: last,
+			InactiveDays: int(now.Sub(*last).Hours() / 24),
+		})
+	}
+	sort.Slice(stale, func(i, j int) bool { return stale[i].LastActivity.Before(*stale[j].LastActivity) })
+
+	if workers < 1 {
+		workers = 1
+	}
+	queue := make(chan *StaleRoom)
+	var wait sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for room := range queue {
+				limiter.Wait()
+				memberships, err := ListAllMemberships(room.ID)
+				if err != nil {
+					room.Error = err.Error()
+					continue
+				}
+				room.Members = len(memberships)
+				for _, membership := range memberships {
+					if membership.PersonID == me.ID {
+						room.MembershipID = membership.ID
+						room.IsModerator = membership.IsModerator
+					}
+				}
+			}
+		}()
+	}
+	for _, room := range stale {
+		queue <- room
+	}
+	close(queue)
+	wait.Wait()
+	return stale, nil
+}
+
+// roomsStaleCmd represents the rooms stale command
+var roomsStaleCmd = &cobra.Command{
+	Use:   "stale",
+	Short: "List the rooms without recent activity",
+	Long: `Lists the rooms without activity for --inactive-for, a duration such as 180d, from the least recently active.
+The rooms that never had any activity are dated by their creation.
+
+Every room is shown with its number of members and whether the authenticated user is a moderator,
+the memberships are listed by -w/--workers workers, sharing --rate requests per second.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		inactiveFor, err := ParseAge(staleInactiveFor)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rooms, err := ListStaleRooms(inactiveFor, staleWorkers, NewRateLimiter(staleRate))
+		if err != nil {
+			log.Fatal(err)
+		}
+		PrintResponseFormat(rooms)
+	},
+}
+
+// roomsCleanupCmd represents the rooms cleanup command
+var roomsCleanupCmd = &cobra.Command{
+	Use:   "cleanup",
+	Short: "Leave or delete the rooms without recent activity",
+	Long: `Leaves or deletes the rooms without activity for --inactive-for, a duration such as 365d.
+
+Use --action leave to remove the authenticated user from the rooms, or --action delete to delete the rooms for everyone.
+The 1:1 direct rooms are skipped, as they can be neither left nor deleted, and so are the rooms where the authenticated user
+is not a moderator with --action delete.
+Use --dry-run to only show the rooms that would be cleaned up, and --report to write the results to a CSV file.
+The rooms are listed and cleaned up by -w/--workers workers, sharing --rate requests per second and retrying when rate limited.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if cleanupAction != "leave" && cleanupAction != "delete" {
+			log.Fatalf("invalid action %s, use leave or delete", cleanupAction)
+		}
+		inactiveFor, err := ParseAge(cleanupInactiveFor)
+		if err != nil {
+			log.Fatal(err)
+		}
+		limiter := NewRateLimiter(cleanupRate)
+		rooms, err := ListStaleRooms(inactiveFor, cleanupWorkers, limiter)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(rooms) == 0 {
+			fmt.Fprintln(os.Stderr, "No stale rooms")
+			return
+		}
+
+		if !cleanupDryRun && !cleanupYes && !Confirm(fmt.Sprintf("%s %d rooms inactive for %s?", strings.Title(cleanupAction), len(rooms), cleanupInactiveFor)) {
+			fmt.Fprintln(os.Stderr, "Aborted")
+			os.Exit(-1)
+		}
+
+		results := make([]*CleanupResult, len(rooms))
+		failed := RunBulk(len(rooms), cleanupWorkers, func(index int) (string, *BulkStatus) {
+			room := rooms[index]
+			result := &CleanupResult{
+				ID:           room.ID,
+				Title:        room.Title,
+				Type:         room.Type,
+				LastActivity: room.LastActivity,
+				InactiveDays: room.InactiveDays,
+				Action:       cleanupAction,
+			}
+			results[index] = result
+
+			var skip string
+			var err error
+			switch {
+			case room.Error != "":
+				err = fmt.Errorf("%s", room.Error)
+			case cleanupAction == "leave" && room.Type == "direct":
+				skip = "direct rooms cannot be left"
+			case cleanupAction == "delete" && room.Type == "direct":
+				skip = "direct rooms cannot be deleted"
+			case cleanupAction == "leave" && room.MembershipID == "":
+				err = fmt.Errorf("membership not found")
+			case cleanupAction == "delete" && !room.IsModerator:
+				skip = "not a moderator"
+			}
+			switch {
+			case err != nil:
+			case skip != "":
+				result.Status = "skipped"
+				result.Error = skip
+				return room.Title, &result.BulkStatus
+			case cleanupDryRun:
+				result.Status = "planned"
+				return room.Title, &result.BulkStatus
+			case cleanupAction == "leave":
+				err = DeleteMembershipWithRetry(limiter, room.MembershipID)
+			default:
+				err = DeleteRoomWithRetry(limiter, room.ID)
+			}
+			if err != nil {
+				result.Fail(err)
+			} else {
+				result.Status = "done"
+			}
+			return room.Title, &result.BulkStatus
+		})
+		FinishBulk(results, failed, cleanupReport)
+	},
+}
+
+func init() {
+	roomsCmd.AddCommand(roomsStaleCmd)
+	roomsCmd.AddCommand(roomsCleanupCmd)
+
+	roomsStaleCmd.Flags().StringVar(&staleInactiveFor, "inactive-for", "180d", "List the rooms without activity for this duration.")
+	roomsStaleCmd.Flags().IntVarP(&staleWorkers, "workers", "w", 4, "The number of rooms whose memberships are listed concurrently.")
+	roomsStaleCmd.Flags().Float64Var(&staleRate, "rate", 5, "The maximum number of requests per second.")
+
+	roomsCleanupCmd.Flags().StringVar(&cleanupInactiveFor, "inactive-for", "365d", "Clean up the rooms without activity for this duration.")
+	roomsCleanupCmd.Flags().StringVar(&cleanupAction, "action", "leave", "leave or delete the rooms.")
+	roomsCleanupCmd.Flags().BoolVar(&cleanupDryRun, "dry-run", false, "Only show the rooms that would be cleaned up.")
+	roomsCleanupCmd.Flags().Float64Var(&cleanupRate, "rate", 5, "The maximum number of requests per second.")
+	roomsCleanupCmd.Flags().StringVar(&cleanupReport, "report", "", "Write the results to this CSV file.")
+	roomsCleanupCmd.Flags().IntVarP(&cleanupWorkers, "workers", "w", 4, "The number of rooms listed and cleaned up concurrently.")
+	roomsCleanupCmd.Flags().BoolVarP(&cleanupYes, "yes", "y", false, "Do not ask for confirmation.")
+}
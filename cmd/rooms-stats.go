@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jbogarin/go-cisco-spark/ciscospark"
+	"github.com/spf13/cobra"
+)
+
+var statsRoomID, statsSince string
+var statsRate float64
+
+// PersonStats is the activity of a person in a room
+type PersonStats struct {
+	PersonEmail       string `json:"personEmail"`
+	PersonDisplayName string `json:"personDisplayName,omitempty"`
+	Messages          int    `json:"messages"`
+	Attachments       int    `json:"attachments"`
+}
+
+// RoomStats is the activity of a room since a date
+type RoomStats struct {
+	RoomID             string         `json:"roomId"`
+	RoomTitle          string         `json:"roomTitle"`
+	Since              time.Time      `json:"since"`
+	Messages           int            `json:"messages"`
+	People             []*PersonStats `json:"people"`
+	ActiveDays         int            `json:"activeDays"`
+	Hours              [24]int        `json:"hours"`
+	Files              int            `json:"files"`
+	Cards              int            `json:"cards"`
+	Threads            int            `json:"threads"`
+	Replies            int            `json:"replies"`
+	MedianResponseTime string         `json:"medianResponseTime,omitempty"`
+}
+
+// RoomStatsRow is a row of the CSV output of rooms stats
+type RoomStatsRow struct {
+	Section string `csv:"section"`
+	Key     string `csv:"key"`
+	Value   string `csv:"value"`
+}
+
+// roomStatsRows flattens the stats of a room into section, key and value rows
+func roomStatsRows(stats *RoomStats) []*RoomStatsRow {
+	rows := []*RoomStatsRow{
+		{"summary", "roomId", stats.RoomID},
+		{"summary", "roomTitle", stats.RoomTitle},
+		{"summary", "since", stats.Since.Format(time.RFC3339)},
+		{"summary", "messages", strconv.Itoa(stats.Messages)},
+		{"summary", "activeDays", strconv.Itoa(stats.ActiveDays)},
+		{"summary", "files", strconv.Itoa(stats.Files)},
+		{"summary", "cards", strconv.Itoa(stats.Cards)},
+		{"summary", "threads", strconv.Itoa(stats.Threads)},
+		{"summary", "replies", strconv.Itoa(stats.Replies)},
+		{"summary", "medianResponseTime", stats.MedianResponseTime},
+	}
+	for _, person := range stats.People {
+		rows = append(rows, &RoomStatsRow{"messages", person.PersonEmail, strconv.Itoa(person.Messages)})
+	}
+	for hour, count := range stats.Hours {
+		rows = append(rows, &RoomStatsRow{"hours", fmt.Sprintf("%02d", hour), strconv.Itoa(count)})
+	}
+	return rows
+}
+
+// medianDuration returns the median of durations, rounded to the second
+func medianDuration(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	middle := len(durations) / 2
+	if len(durations)%2 == 0 {
+		return ((durations[middle-1] + durations[middle]) / 2).Round(time.Second)
+	}
+	return durations[middle].Round(time.Second)
+}
+
+// CollectRoomStats walks the history of a room back to since and computes its activity
+func CollectRoomStats(room *SparkRoom, since time.Time, limiter *RateLimiter) (*RoomStats, error) {
+	stats := &RoomStats{RoomID: room.ID, RoomTitle: room.Title, Since: since}
+	queryParams := &ciscospark.MessageQueryParams{
+		Max:    exportPageSize,
+		RoomID: room.ID,
+	}
+
+	// the messages are listed from the newest, they are kept to compute the response times from the oldest
+	var messages []*SparkMessage
+	for {
+		page, err := ListSparkMessagesWithRetry(limiter, queryParams)
+		if err != nil {
+			return nil, err
+		}
+		done := len(page) < exportPageSize
+		for _, message := range page {
+			if message.Created != nil && message.Created.Before(since) {
+				done = true
+				break
+			}
+			messages = append(messages, message)
+		}
+		if done {
+			break
+		}
+		queryParams.BeforeMessage = page[len(page)-1].ID
+	}
+
+	people := make(map[string]*PersonStats)
+	days := make(map[string]bool)
+	threads := make(map[string]bool)
+	var responseTimes []time.Duration
+	var previous *SparkMessage
+	for i := len(messages) - 1; i >= 0; i-- {
+		message := messages[i]
+		stats.Messages++
+		stats.Files += len(message.Files)
+		stats.Cards += len(message.Attachments)
+
+		person, ok := people[message.PersonEmail]
+		if !ok {
+			person = &PersonStats{PersonEmail: message.PersonEmail, PersonDisplayName: PersonDisplayName(message.PersonID, message.PersonEmail)}
+			people[message.PersonEmail] = person
+		}
+		person.Messages++
+		person.Attachments += len(message.Files)
+
+		if message.ParentID != "" {
+			threads[message.ParentID] = true
+			stats.Replies++
+		}
+
+		if message.Created == nil {
+			continue
+		}
+		created := message.Created.Local()
+		days[created.Format("2006-01-02")] = true
+		stats.Hours[created.Hour()]++
+		if previous != nil && previous.PersonEmail != message.PersonEmail {
+			responseTimes = append(responseTimes, message.Created.Sub(*previous.Created))
+		}
+		previous = message
+	}
+
+	for _, person := range people {
+		stats.People = append(stats.People, person)
+	}
+	sort.Slice(stats.People, func(i, j int) bool {
+		if stats.People[i].Messages != stats.People[j].Messages {
+			return stats.People[i].Messages > stats.People[j].Messages
+		}
+		return stats.People[i].PersonEmail < stats.People[j].PersonEmail
+	})
+	stats.ActiveDays = len(days)
+	stats.Threads = len(threads)
+	if len(responseTimes) > 0 {
+		stats.MedianResponseTime = medianDuration(responseTimes).String()
+	}
+	return stats, nil
+}
+
+// roomsStatsCmd represents the rooms stats command
+var roomsStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show the activity of a room",
+	Long: `Shows the activity of a room since a date: the messages per person, the number of days with messages,
+the messages per hour of the day (local time), the files and cards posted, the threads and their replies,
+and the median response time, the time between a message and the next message of another person.
+
+Specify the room with the -i/--id flag, and the date with --since, an ISO8601 date or a duration such as 30d.
+With -f csv, the stats are printed as section, key and value rows.`,
+	PreRun: resolveRoomFlags("id"),
+	Run: func(cmd *cobra.Command, args []string) {
+		if statsRoomID == "" {
+			fmt.Println(cmd.Help())
+			os.Exit(-1)
+		}
+		since, err := ParseTime(statsSince)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		room, err := GetSparkRoom(statsRoomID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		stats, err := CollectRoomStats(room, since, NewRateLimiter(statsRate))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if format == "csv" {
+			PrintResponseFormat(roomStatsRows(stats))
+			return
+		}
+		PrintResponseFormat(stats)
+	},
+}
+
+func init() {
+	roomsCmd.AddCommand(roomsStatsCmd)
+
+	roomsStatsCmd.Flags().StringVarP(&statsRoomID, "id", "i", "", "Room ID or name.")
+	roomsStatsCmd.Flags().StringVar(&statsSince, "since", "30d", "Only count the messages sent after this date or duration ago.")
+	roomsStatsCmd.Flags().Float64Var(&statsRate, "rate", 5, "The maximum number of requests per second.")
+
+	setIDFlagType(roomsStatsCmd, "id", "ROOM")
+}
@@ -109,7 +109,8 @@ var roomsGetCmd = &cobra.Command{
 	Short: "Get room details",
 	Long: `Shows details for a room, by ID.
 
-Specify the room ID with the -i/--id flag.`,
+Specify the room ID or name with the -i/--id flag.`,
+	PreRun: resolveRoomFlags("id"),
 	Run: func(cmd *cobra.Command, args []string) {
 		room, response, err := SparkClient.Rooms.GetRoom(roomID)
 		if verbose {
@@ -136,7 +137,8 @@ var roomsUpdateCmd = &cobra.Command{
 	Short: "Update a room",
 	Long: `Updates details for a room, by ID.
 
-Specify the room ID with the -i/--id flag.`,
+Specify the room ID or name with the -i/--id flag.`,
+	PreRun: resolveRoomFlags("id"),
 	Run: func(cmd *cobra.Command, args []string) {
 
 		updateRoomRequest := &ciscospark.UpdateRoomRequest{
@@ -162,7 +164,8 @@ var roomsDeleteCmd = &cobra.Command{
 	Short: "Delete a room",
 	Long: `Deletes a room, by ID.
 
-Specify the room ID with the -i/--id flag`,
+Specify the room ID or name with the -i/--id flag, a name only matching part of the room title is confirmed first.`,
+	PreRun: resolveRoomFlagsConfirmed(nil, "id"),
 	Run: func(cmd *cobra.Command, args []string) {
 
 		if roomID == "" {
@@ -196,10 +199,15 @@ func init() {
 	roomsCreateCmd.Flags().StringVarP(&roomName, "name", "n", "", "A user-friendly name for the room.")
 	roomsCreateCmd.Flags().StringVarP(&roomTeamID, "team", "T", "", "The ID for the team with which this room is associated.")
 
-	roomsUpdateCmd.Flags().StringVarP(&roomID, "id", "i", "", "The Room ID")
+	roomsUpdateCmd.Flags().StringVarP(&roomID, "id", "i", "", "The Room, by ID or name")
 
-	roomsGetCmd.Flags().StringVarP(&roomID, "id", "i", "", "The Room ID")
+	roomsGetCmd.Flags().StringVarP(&roomID, "id", "i", "", "The Room, by ID or name")
 
-	roomsDeleteCmd.Flags().StringVarP(&roomID, "id", "i", "", "The Room ID")
+	roomsDeleteCmd.Flags().StringVarP(&roomID, "id", "i", "", "The Room, by ID or name")
 
+	setIDFlagType(roomsListCmd, "team", "TEAM")
+	setIDFlagType(roomsCreateCmd, "team", "TEAM")
+	setIDFlagType(roomsUpdateCmd, "id", "ROOM")
+	setIDFlagType(roomsGetCmd, "id", "ROOM")
+	setIDFlagType(roomsDeleteCmd, "id", "ROOM")
 }
@@ -17,6 +17,9 @@ var verbose bool
 // SparkClient is Cisco Spark Client
 var SparkClient *ciscospark.Client
 
+// HTTPClient is the HTTP client used by SparkClient, also used to download and upload files
+var HTTPClient *http.Client
+
 // Max results to return
 var Max int
 
@@ -29,8 +32,8 @@ var RootCmd = &cobra.Command{
 		tr := &http.Transport{
 			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 		}
-		client := &http.Client{Transport: tr}
-		SparkClient = ciscospark.NewClient(client)
+		HTTPClient = &http.Client{Transport: tr}
+		SparkClient = ciscospark.NewClient(HTTPClient)
 		var token string
 		viper.BindEnv("CISCO_SPARK_TOKEN")
 		if viper.IsSet("CISCO_SPARK_TOKEN") {
@@ -42,6 +45,8 @@ var RootCmd = &cobra.Command{
 			os.Exit(-1)
 		}
 		SparkClient.Authorization = "Bearer " + token
+		expandAliasFlags(cmd)
+		normalizeIDFlags(cmd)
 	},
 }
 
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxMessageSize is the maximum size, in bytes, of a message accepted by Spark
+const MaxMessageSize = 7439
+
+// splitPartReserve is the room left in every part for its [n/total] header
+const splitPartReserve = len("[999/999]\n")
+
+// messageBlock is a paragraph of a message, or a fenced code block with its opening line and fence marker
+type messageBlock struct {
+	lines  []string
+	fence  string
+	marker string
+}
+
+// fenceMarker returns the run of three or more backticks or tildes opening a markdown code fence, or an empty string
+func fenceMarker(line string) string {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || trimmed[0] != '`' && trimmed[0] != '~' {
+		return ""
+	}
+	n := 0
+	for n < len(trimmed) && trimmed[n] == trimmed[0] {
+		n++
+	}
+	if n < 3 {
+		return ""
+	}
+	return trimmed[:n]
+}
+
+// closesFence returns whether the line closes the code fence opened with the marker:
+// the same character, at least as many times, and nothing else
+func closesFence(line, marker string) bool {
+	closing := fenceMarker(line)
+	return closing != "" && closing[0] == marker[0] && len(closing) >= len(marker) && closing == strings.TrimSpace(line)
+}
+
+// messageBlocks splits a message into paragraphs, keeping each fenced code block as one block
+func messageBlocks(body string) []*messageBlock {
+	var blocks []*messageBlock
+	var current *messageBlock
+	for _, line := range strings.Split(body, "\n") {
+		switch {
+		case current != nil && current.fence != "":
+			current.lines = append(current.lines, line)
+			if closesFence(line, current.marker) {
+				current = nil
+			}
+		case fenceMarker(line) != "":
+			current = &messageBlock{lines: []string{line}, fence: strings.TrimSpace(line), marker: fenceMarker(line)}
+			blocks = append(blocks, current)
+		case strings.TrimSpace(line) == "":
+			current = nil
+		default:
+			if current == nil {
+				current = &messageBlock{}
+				blocks = append(blocks, current)
+			}
+			current.lines = append(current.lines, line)
+		}
+	}
+	return blocks
+}
+
+// splitLine splits a line into pieces of at most limit bytes, without breaking UTF-8 characters
+func splitLine(line string, limit int) []string {
+	var pieces []string
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		if cut == 0 {
+			cut = limit
+		}
+		pieces = append(pieces, line[:cut])
+		line = line[cut:]
+	}
+	return append(pieces, line)
+}
+
+// packLines joins lines into pieces of at most limit bytes
+func packLines(lines []string, limit int) []string {
+	var pieces []string
+	var current []string
+	size := 0
+	for _, line := range lines {
+		for _, piece := range splitLine(line, limit) {
+			if len(current) > 0 && size+1+len(piece) > limit {
+				pieces = append(pieces, strings.Join(current, "\n"))
+				current, size = nil, 0
+			}
+			if len(current) > 0 {
+				size++
+			}
+			current = append(current, piece)
+			size += len(piece)
+		}
+	}
+	if len(current) > 0 {
+		pieces = append(pieces, strings.Join(current, "\n"))
+	}
+	return pieces
+}
+
+// blockPieces returns the block as pieces of at most limit bytes, reopening and closing the code fence in every piece
+func blockPieces(block *messageBlock, limit int) []string {
+	text := strings.Join(block.lines, "\n")
+	if len(text) <= limit {
+		return []string{text}
+	}
+	if block.fence == "" {
+		return packLines(block.lines, limit)
+	}
+
+	inner := block.lines[1:]
+	if len(inner) > 0 && closesFence(inner[len(inner)-1], block.marker) {
+		inner = inner[:len(inner)-1]
+	}
+	closing := block.marker
+	var pieces []string
+	for _, piece := range packLines(inner, limit-len(block.fence)-len(closing)-2) {
+		pieces = append(pieces, block.fence+"\n"+piece+"\n"+closing)
+	}
+	return pieces
+}
+
+// SplitMessage splits a message into parts of at most limit bytes, on paragraph and line boundaries.
+// Code fences are closed at the end of a part and reopened in the next one, and the parts are numbered.
+func SplitMessage(body string, limit int) []string {
+	if len(body) <= limit {
+		return []string{body}
+	}
+	limit -= splitPartReserve
+
+	var parts []string
+	var current string
+	for _, block := range messageBlocks(body) {
+		for _, piece := range blockPieces(block, limit) {
+			if current != "" && len(current)+2+len(piece) > limit {
+				parts = append(parts, current)
+				current = ""
+			}
+			if current != "" {
+				current += "\n\n"
+			}
+			current += piece
+		}
+	}
+	if current != "" {
+		parts = append(parts, current)
+	}
+
+	for i := range parts {
+		parts[i] = fmt.Sprintf("[%d/%d]\n%s", i+1, len(parts), parts[i])
+	}
+	return parts
+}
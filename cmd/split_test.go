@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitMessage(t *testing.T) {
+	paragraphs := strings.Repeat("lorem ipsum dolor sit amet\n\n", 10)
+	code := "```go\n" + strings.Repeat("fmt.Println(\"hello\")\n", 10) + "```"
+	nested := "````md\n" + strings.Repeat("```\ninside\n```\n", 5) + "````"
+	accents := strings.Repeat("é", 100)
+
+	tests := []struct {
+		name  string
+		body  string
+		limit int
+		parts int
+		check func(t *testing.T, part string)
+	}{
+		{
+			name:  "short message",
+			body:  "hello",
+			limit: 100,
+			parts: 1,
+		},
+		{
+			name:  "paragraphs",
+			body:  paragraphs,
+			limit: 80,
+			parts: 5,
+		},
+		{
+			name:  "code fence reopened",
+			body:  code,
+			limit: 100,
+			parts: 4,
+			check: func(t *testing.T, part string) {
+				lines := strings.Split(part, "\n")
+				if lines[1] != "```go" || lines[len(lines)-1] != "```" {
+					t.Errorf("part %q does not open and close the fence", part)
+				}
+			},
+		},
+		{
+			name:  "four backtick fence reopened",
+			body:  nested,
+			limit: 60,
+			parts: 3,
+			check: func(t *testing.T, part string) {
+				lines := strings.Split(part, "\n")
+				if lines[1] != "````md" || lines[len(lines)-1] != "````" {
+					t.Errorf("part %q does not open and close the four backtick fence", part)
+				}
+			},
+		},
+		{
+			name:  "UTF-8 boundaries",
+			body:  accents,
+			limit: 75,
+			parts: 4,
+			check: func(t *testing.T, part string) {
+				if !utf8.ValidString(part) {
+					t.Errorf("part %q breaks a UTF-8 character", part)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parts := SplitMessage(test.body, test.limit)
+			if len(parts) != test.parts {
+				t.Fatalf("got %d parts, want %d: %q", len(parts), test.parts, parts)
+			}
+			for i, part := range parts {
+				if len(part) > test.limit {
+					t.Errorf("part %d is %d bytes, the limit is %d", i+1, len(part), test.limit)
+				}
+				if len(parts) > 1 && !strings.HasPrefix(part, fmt.Sprintf("[%d/%d]\n", i+1, len(parts))) {
+					t.Errorf("part %d is not numbered: %q", i+1, part)
+				}
+				if test.check != nil && len(parts) > 1 {
+					test.check(t, part)
+				}
+			}
+		})
+	}
+}
+
+func TestMessageBlocks(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		blocks int
+	}{
+		{"paragraphs", "a\nb\n\nc", 2},
+		{"code fence with a blank line", "```\na\n\nb\n```\n\nc", 2},
+		{"shorter fence inside a longer one", "````\n```\na\n```\n\nb\n````\n\nc", 2},
+		{"tilde fence", "~~~\na\n\n```\n~~~\nb", 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if blocks := messageBlocks(test.body); len(blocks) != test.blocks {
+				t.Errorf("got %d blocks, want %d", len(blocks), test.blocks)
+			}
+		})
+	}
+}
@@ -50,8 +50,10 @@ Use teamId with -i/--id flag to list memberships for a team.`,
 var teamMembershipsCreateCmd = &cobra.Command{
 	Use:   "create",
 	Short: "Create a Team Membership.",
-	Long:  `Add someone to a team by Person ID or email address; optionally making them a moderator.`,
+	Long: `Add someone to a team by Person ID or email address; optionally making them a moderator.
 
+Use -p/--person-id to define the person, by ID, email address, display name or me.`,
+	PreRun: resolvePersonFlags("person-id"),
 	Run: func(cmd *cobra.Command, args []string) {
 		teamMembershipRequest := &ciscospark.TeamMembershipRequest{
 			TeamID:      teamMembershipsID,
@@ -59,6 +61,10 @@ var teamMembershipsCreateCmd = &cobra.Command{
 			IsModerator: teamMembershipsModerator,
 		}
 
+		if teamMembershipsPersonID != "" {
+			teamMembershipRequest.PersonID = teamMembershipsPersonID
+		}
+
 		newTeamMembership, response, err := SparkClient.TeamMemberships.Post(teamMembershipRequest)
 		if verbose {
 			PrintRequestWithBody(response.Request, teamMembershipRequest)
@@ -147,7 +153,7 @@ func init() {
 	teamMembershipsListCmd.Flags().StringVarP(&teamMembershipsID, "", "i", "", "Limit results to a specific team, by ID.")
 
 	teamMembershipsCreateCmd.Flags().StringVarP(&teamMembershipsID, "i", "i", "", "The team ID.")
-	teamMembershipsCreateCmd.Flags().StringVarP(&teamMembershipsPersonID, "person-id", "p", "", "The person ID.")
+	teamMembershipsCreateCmd.Flags().StringVarP(&teamMembershipsPersonID, "person-id", "p", "", "The person, by ID, email address, display name or me.")
 	teamMembershipsCreateCmd.Flags().StringVarP(&teamMembershipsPersonEmail, "person-email", "e", "", "The email address of the person.")
 	teamMembershipsCreateCmd.Flags().BoolVarP(&teamMembershipsModerator, "moderator", "M", false, "Set to true to make the person a room moderator")
 
@@ -158,4 +164,9 @@ func init() {
 
 	teamMembershipsDeleteCmd.Flags().StringVarP(&teamMembershipsID, "id", "i", "", "The teamMemberships ID.")
 
+	setIDFlagType(teamMembershipsCreateCmd, "i", "TEAM")
+	setIDFlagType(teamMembershipsCreateCmd, "person-id", "PEOPLE")
+	setIDFlagType(teamMembershipsGetCmd, "id", "TEAM_MEMBERSHIP")
+	setIDFlagType(teamMembershipsUpdateCmd, "id", "TEAM_MEMBERSHIP")
+	setIDFlagType(teamMembershipsDeleteCmd, "id", "TEAM_MEMBERSHIP")
 }
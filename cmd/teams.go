@@ -172,4 +172,7 @@ func init() {
 
 	teamsDeleteCmd.Flags().StringVarP(&teamID, "id", "i", "", "the team ID")
 
+	setIDFlagType(teamsGetCmd, "id", "TEAM")
+	setIDFlagType(teamsUpdateCmd, "id", "TEAM")
+	setIDFlagType(teamsDeleteCmd, "id", "TEAM")
 }
@@ -1,12 +1,18 @@
 package cmd
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gocarina/gocsv"
 	prettyjson "github.com/hokaccha/go-prettyjson"
@@ -67,6 +73,16 @@ func PrintCSV(response interface{}) {
 
 }
 
+// WriteCSVFile writes the rows in CSV to a file
+func WriteCSVFile(path string, rows interface{}) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return gocsv.MarshalFile(rows, file)
+}
+
 // PrintResponseFormat prints the response depending on the format flag
 func PrintResponseFormat(response interface{}) {
 	if format == "json" {
@@ -77,3 +93,118 @@ func PrintResponseFormat(response interface{}) {
 		PrintJSON(response)
 	}
 }
+
+// ParseAge parses a duration such as 90d, 2w, 36h or 30m
+func ParseAge(age string) (time.Duration, error) {
+	units := map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	}
+	for suffix, unit := range units {
+		if strings.HasSuffix(age, suffix) {
+			count, err := strconv.ParseFloat(strings.TrimSuffix(age, suffix), 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %s", age)
+			}
+			return time.Duration(count * float64(unit)), nil
+		}
+	}
+	return time.ParseDuration(age)
+}
+
+// ParseTime parses a date in ISO8601 format, or a duration such as 7d meaning that long ago
+func ParseTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	age, err := ParseAge(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %s, use an ISO8601 date or a duration such as 7d", value)
+	}
+	return time.Now().Add(-age), nil
+}
+
+// Confirm asks a yes/no question on the terminal, it returns true only when the answer is yes
+func Confirm(question string) bool {
+	fmt.Fprint(os.Stderr, question+" [y/N] ")
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// BulkStatus is the status of an item processed by a bulk command, such as sent, skipped or failed
+type BulkStatus struct {
+	Status string `json:"status" csv:"status"`
+	Error  string `json:"error,omitempty" csv:"error"`
+}
+
+// Fail marks the item as failed with the error
+func (s *BulkStatus) Fail(err error) {
+	s.Status = "failed"
+	s.Error = err.Error()
+}
+
+// RunBulk processes the items 0 to count-1 with workers workers. process returns the name of an item,
+// shown in the progress printed on stderr, and its status. It returns the number of failed items.
+func RunBulk(count, workers int, process func(index int) (string, *BulkStatus)) int {
+	if workers < 1 {
+		workers = 1
+	}
+	var mutex sync.Mutex
+	counts := make(map[string]int)
+	queue := make(chan int)
+	var wait sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for index := range queue {
+				name, status := process(index)
+				mutex.Lock()
+				counts[status.Status]++
+				if status.Status == "failed" {
+					fmt.Fprintf(os.Stderr, "Failed %s: %s\n", name, status.Error)
+				} else {
+					fmt.Fprintf(os.Stderr, "%s: %s\n", name, status.Status)
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	for index := 0; index < count; index++ {
+		queue <- index
+	}
+	close(queue)
+	wait.Wait()
+
+	statuses := make([]string, 0, len(counts))
+	for status := range counts {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	summary := make([]string, len(statuses))
+	for i, status := range statuses {
+		summary[i] = fmt.Sprintf("%d %s", counts[status], status)
+	}
+	fmt.Fprintf(os.Stderr, "%d items: %s\n", count, strings.Join(summary, ", "))
+	return counts["failed"]
+}
+
+// FinishBulk writes the results of a bulk command to the report CSV file when it is set, prints them,
+// and exits with 1 when an item failed
+func FinishBulk(results interface{}, failed int, report string) {
+	if report != "" {
+		if err := WriteCSVFile(report, results); err != nil {
+			log.Fatal(err)
+		}
+	}
+	PrintResponseFormat(results)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,278 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jbogarin/go-cisco-spark/ciscospark"
+	"github.com/spf13/cobra"
+)
+
+var waitRoomID, waitMatch, waitRejectMatch, waitFrom, waitEventsFile string
+var waitTimeout, waitInterval time.Duration
+
+// Exit codes of the wait command
+const (
+	waitExitRejected = 3
+	waitExitTimeout  = 2
+)
+
+// waitMatcher decides whether a message or card submission approves or rejects the wait
+type waitMatcher struct {
+	match, reject *regexp.Regexp
+	from          string
+}
+
+// check returns whether the content from the sender matches the approval or the rejection expression
+func (m *waitMatcher) check(senderEmails []string, content string) (approved, rejected bool) {
+	if m.from != "" {
+		found := false
+		for _, email := range senderEmails {
+			if strings.EqualFold(email, m.from) {
+				found = true
+			}
+		}
+		if !found {
+			return false, false
+		}
+	}
+
+	if m.reject != nil && m.reject.MatchString(content) {
+		return false, true
+	}
+	return m.match.MatchString(content), false
+}
+
+// attachmentActionContent returns the inputs of a card submission as key=value lines, sorted by key
+func attachmentActionContent(action *AttachmentAction) string {
+	var lines []string
+	for key, value := range action.Inputs {
+		lines = append(lines, fmt.Sprintf("%s=%v", key, value))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+// readWaitEvents reads the webhook events appended to the events file since the last read
+func readWaitEvents(reader *bufio.Reader, pending *string) []*WebhookEvent {
+	var events []*WebhookEvent
+	for {
+		line, err := reader.ReadString('\n')
+		*pending += line
+		if err == io.EOF {
+			return events
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return events
+		}
+
+		event := new(WebhookEvent)
+		if err := json.Unmarshal([]byte(*pending), event); err != nil {
+			fmt.Fprintln(os.Stderr, "Skipping invalid event:", err)
+		} else {
+			events = append(events, event)
+		}
+		*pending = ""
+	}
+}
+
+// waitForCardSubmission checks a webhook event for a card submission in the room
+func waitForCardSubmission(event *WebhookEvent, matcher *waitMatcher) (action *AttachmentAction, approved, rejected bool) {
+	if event.Resource != "attachmentActions" || event.Event != "created" {
+		return nil, false, false
+	}
+
+	// the events written by webhooks listen are already hydrated
+	eventData, err := json.Marshal(event.Data)
+	if err != nil {
+		return nil, false, false
+	}
+	action = new(AttachmentAction)
+	if err := json.Unmarshal(eventData, action); err != nil || action.ID == "" {
+		return nil, false, false
+	}
+	if action.Inputs == nil {
+		if action, err = GetAttachmentAction(action.ID); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return nil, false, false
+		}
+	}
+	if action.RoomID != waitRoomID {
+		return nil, false, false
+	}
+
+	var emails []string
+	if matcher.from != "" {
+		person, _, err := SparkClient.People.GetPerson(action.PersonID)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return nil, false, false
+		}
+		emails = person.Emails
+	}
+
+	approved, rejected = matcher.check(emails, attachmentActionContent(action))
+	return action, approved, rejected
+}
+
+// waitCmd represents the wait command
+var waitCmd = &cobra.Command{
+	Use:   "wait",
+	Short: "Wait for a matching message in a room",
+	Long: `Blocks until a message matching a regular expression is posted in a room, then prints it and exits with 0.
+
+Use -r/--room to define the room and --match to define the regular expression, for example '(?i)^approve'.
+Use --from to only accept messages from a person, by email address, ID, display name or me.
+Use --reject-match to exit with 3 when a matching message is posted instead.
+Use --timeout to stop waiting, the command exits with 2 on timeout, and with 1 on errors.
+
+Use --events-file to also wait for Adaptive Card submissions, reading the events written by webhooks listen --out.
+The card inputs are matched as key=value lines.
+
+Only the messages posted after the command starts are considered.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		resolveRoomFlags("room")(cmd, args)
+		resolvePersonEmailFlags("from")(cmd, args)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if waitRoomID == "" || waitMatch == "" {
+			fmt.Println(cmd.Help())
+			os.Exit(-1)
+		}
+
+		match, err := regexp.Compile(waitMatch)
+		if err != nil {
+			log.Fatal(err)
+		}
+		matcher := &waitMatcher{match: match, from: waitFrom}
+		if waitRejectMatch != "" {
+			if matcher.reject, err = regexp.Compile(waitRejectMatch); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		var events *bufio.Reader
+		var pendingEvent string
+		if waitEventsFile != "" {
+			eventsFile, err := os.OpenFile(waitEventsFile, os.O_CREATE|os.O_RDONLY, 0600)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer eventsFile.Close()
+			if _, err := eventsFile.Seek(0, io.SeekEnd); err != nil {
+				log.Fatal(err)
+			}
+			events = bufio.NewReader(eventsFile)
+		}
+
+		seen := make(map[string]bool)
+		var newest time.Time
+		var messages []*SparkMessage
+		for {
+			var response *ciscospark.Response
+			messages, response, err = ListSparkMessages(&ciscospark.MessageQueryParams{
+				Max:    tailPageSize,
+				RoomID: waitRoomID,
+			})
+			if IsRateLimited(response) {
+				time.Sleep(RetryAfter(response, 2*waitInterval))
+				continue
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+			break
+		}
+		for _, message := range messages {
+			seen[message.ID] = true
+			if message.Created != nil && message.Created.After(newest) {
+				newest = *message.Created
+			}
+		}
+
+		var deadline <-chan time.Time
+		if waitTimeout > 0 {
+			deadline = time.After(waitTimeout)
+		}
+		interval := waitInterval
+
+		for {
+			select {
+			case <-deadline:
+				fmt.Fprintln(os.Stderr, "Timed out after", waitTimeout, "waiting for a matching message")
+				os.Exit(waitExitTimeout)
+			case <-time.After(interval):
+			}
+
+			newMessages, response, err := pollNewMessages(waitRoomID, seen, newest)
+			if IsRateLimited(response) {
+				interval = RetryAfter(response, 2*interval)
+				continue
+			}
+			interval = waitInterval
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+
+			for i := len(newMessages) - 1; i >= 0; i-- {
+				message := newMessages[i]
+				seen[message.ID] = true
+				if message.Created != nil && message.Created.After(newest) {
+					newest = *message.Created
+				}
+
+				content := message.Text
+				if content == "" {
+					content = message.MarkDown
+				}
+				approved, rejected := matcher.check([]string{message.PersonEmail}, content)
+				if rejected {
+					PrintResponseFormat(message)
+					os.Exit(waitExitRejected)
+				}
+				if approved {
+					PrintResponseFormat(message)
+					os.Exit(0)
+				}
+			}
+
+			if events == nil {
+				continue
+			}
+			for _, event := range readWaitEvents(events, &pendingEvent) {
+				action, approved, rejected := waitForCardSubmission(event, matcher)
+				if rejected {
+					PrintResponseFormat(action)
+					os.Exit(waitExitRejected)
+				}
+				if approved {
+					PrintResponseFormat(action)
+					os.Exit(0)
+				}
+			}
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(waitCmd)
+
+	waitCmd.Flags().StringVarP(&waitRoomID, "room", "r", "", "The room, by ID or name.")
+	waitCmd.Flags().StringVar(&waitMatch, "match", "", "Regular expression a message must match.")
+	waitCmd.Flags().StringVar(&waitRejectMatch, "reject-match", "", "Regular expression of the messages that reject the wait.")
+	waitCmd.Flags().StringVar(&waitFrom, "from", "", "Only accept messages from this person, by email address, ID, display name or me.")
+	waitCmd.Flags().DurationVarP(&waitTimeout, "timeout", "t", 0, "Maximum time to wait, for example 30m. Waits forever by default.")
+	waitCmd.Flags().DurationVar(&waitInterval, "interval", 5*time.Second, "The poll interval.")
+	waitCmd.Flags().StringVar(&waitEventsFile, "events-file", "", "Webhook events file written by webhooks listen --out, to wait for card submissions.")
+
+	setIDFlagType(waitCmd, "room", "ROOM")
+}
@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var watchLogFile, watchLogMatch, watchLogRoomID string
+var watchLogContext, watchLogRate int
+var watchLogBurst, watchLogMaxDelay, watchLogDedupe, watchLogPoll time.Duration
+var watchLogFromStart bool
+
+// watchLogMaxPending is the maximum number of lines waiting to be posted, the oldest are dropped beyond it
+const watchLogMaxPending = 500
+
+// logFollower reads the lines appended to a file, reopening it when it is rotated or truncated
+type logFollower struct {
+	path    string
+	file    *os.File
+	info    os.FileInfo
+	reader  *bufio.Reader
+	offset  int64
+	partial string
+}
+
+// open opens the file, starting at its end unless fromStart is true
+func (f *logFollower) open(fromStart bool) error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.offset = 0
+	if !fromStart {
+		if f.offset, err = file.Seek(0, io.SeekEnd); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if f.file != nil {
+		f.file.Close()
+	}
+	f.file, f.info, f.partial = file, info, ""
+	f.reader = bufio.NewReader(file)
+	return nil
+}
+
+// lines returns the complete lines appended since the last call
+func (f *logFollower) lines() []string {
+	if f.file == nil {
+		if err := f.open(true); err != nil {
+			return nil
+		}
+	}
+
+	var lines []string
+	for {
+		line, err := f.reader.ReadString('\n')
+		f.offset += int64(len(line))
+		if err != nil {
+			f.partial += line
+			break
+		}
+		lines = append(lines, strings.TrimRight(f.partial+line, "\r\n"))
+		f.partial = ""
+	}
+
+	// a new file at the path means the file was rotated, a smaller file means it was truncated
+	info, err := os.Stat(f.path)
+	switch {
+	case err != nil:
+		// the file is being rotated, keep reading the old one until the new one appears
+	case !os.SameFile(info, f.info) || info.Size() < f.offset:
+		if f.partial != "" {
+			lines = append(lines, f.partial)
+		}
+		if err := f.open(true); err == nil {
+			lines = append(lines, f.lines()...)
+		}
+	}
+	return lines
+}
+
+// watchLogMessage formats the pending lines as a code block message
+func watchLogMessage(pending []string, matches, dropped int) string {
+	header := fmt.Sprintf("**%s**: %d matching line(s)", filepath.Base(watchLogFile), matches)
+	if dropped > 0 {
+		header += fmt.Sprintf(", %d line(s) dropped by the rate limit", dropped)
+	}
+	return header + "\n```\n" + strings.Join(pending, "\n") + "\n```"
+}
+
+// watchLogCmd represents the watch-log command
+var watchLogCmd = &cobra.Command{
+	Use:   "watch-log",
+	Short: "Post the lines of a log file matching a regular expression",
+	Long: `Follows a log file, across rotations, and posts the lines matching a regular expression to a room.
+
+Use --file to define the log file, --match to define the regular expression, for example 'ERROR|panic',
+and -r/--room to define the room.
+
+Matching lines close in time are grouped into one message: a group is posted after --burst without new matches,
+or --max-delay after its first match when the matches keep coming.
+Use -C/--context to include lines before and after every match.
+A line already posted within --dedupe is not posted again, and at most --rate messages are posted per minute.`,
+	PreRun: resolveRoomFlags("room"),
+	Run: func(cmd *cobra.Command, args []string) {
+		if watchLogFile == "" || watchLogMatch == "" || watchLogRoomID == "" {
+			fmt.Println(cmd.Help())
+			os.Exit(-1)
+		}
+		match, err := regexp.Compile(watchLogMatch)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		follower := &logFollower{path: watchLogFile}
+		if err := follower.open(watchLogFromStart); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintln(os.Stderr, "Watching", watchLogFile)
+
+		var before, pending []string
+		var posts []time.Time
+		lastPosted := make(map[string]time.Time)
+		after, matches, dropped := 0, 0, 0
+		var lastMatch, groupStart time.Time
+
+		for {
+			now := time.Now()
+			for _, line := range follower.lines() {
+				if match.MatchString(line) {
+					if posted, ok := lastPosted[line]; ok && now.Sub(posted) < watchLogDedupe {
+						continue
+					}
+					lastPosted[line] = now
+					pending = append(pending, before...)
+					pending = append(pending, line)
+					before = nil
+					after = watchLogContext
+					if matches == 0 {
+						groupStart = now
+					}
+					matches++
+					lastMatch = now
+					continue
+				}
+
+				if after > 0 {
+					pending = append(pending, line)
+					after--
+					continue
+				}
+				if watchLogContext > 0 {
+					before = append(before, line)
+					if len(before) > watchLogContext {
+						before = before[1:]
+					}
+				}
+			}
+
+			if len(pending) > watchLogMaxPending {
+				fmt.Fprintf(os.Stderr, "Dropping %d line(s), more than %d lines are waiting to be posted\n", len(pending)-watchLogMaxPending, watchLogMaxPending)
+				dropped += len(pending) - watchLogMaxPending
+				pending = pending[len(pending)-watchLogMaxPending:]
+			}
+
+			// post the group once the burst is over, or once it is --max-delay old, within the rate limit
+			for len(posts) > 0 && now.Sub(posts[0]) > time.Minute {
+				posts = posts[1:]
+			}
+			groupDone := now.Sub(lastMatch) >= watchLogBurst || now.Sub(groupStart) >= watchLogMaxDelay
+			if matches > 0 && groupDone && len(posts) < watchLogRate {
+				for _, part := range SplitMessage(watchLogMessage(pending, matches, dropped), MaxMessageSize) {
+					if _, err := PostSparkMessage(&SparkMessageRequest{RoomID: watchLogRoomID, MarkDown: part}); err != nil {
+						fmt.Fprintln(os.Stderr, "Unable to post the lines:", err)
+					}
+				}
+				posts = append(posts, now)
+				pending, matches, dropped, after = nil, 0, 0, 0
+			}
+
+			for line, posted := range lastPosted {
+				if now.Sub(posted) >= watchLogDedupe {
+					delete(lastPosted, line)
+				}
+			}
+
+			time.Sleep(watchLogPoll)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(watchLogCmd)
+
+	watchLogCmd.Flags().StringVar(&watchLogFile, "file", "", "The log file to follow.")
+	watchLogCmd.Flags().StringVar(&watchLogMatch, "match", "", "Regular expression of the lines to post.")
+	watchLogCmd.Flags().StringVarP(&watchLogRoomID, "room", "r", "", "The room, by ID or name.")
+	watchLogCmd.Flags().IntVarP(&watchLogContext, "context", "C", 0, "Number of lines to include before and after every match.")
+	watchLogCmd.Flags().DurationVar(&watchLogBurst, "burst", 5*time.Second, "Group the matches until no new match is found for this long.")
+	watchLogCmd.Flags().DurationVar(&watchLogMaxDelay, "max-delay", time.Minute, "Post a group at most this long after its first match, even when the matches keep coming.")
+	watchLogCmd.Flags().DurationVar(&watchLogDedupe, "dedupe", 5*time.Minute, "Do not post the same line again within this window.")
+	watchLogCmd.Flags().IntVar(&watchLogRate, "rate", 6, "The maximum number of messages posted per minute.")
+	watchLogCmd.Flags().DurationVar(&watchLogPoll, "poll", time.Second, "How often the file is checked for new lines.")
+	watchLogCmd.Flags().BoolVar(&watchLogFromStart, "from-start", false, "Read the file from the start instead of from its end.")
+
+	setIDFlagType(watchLogCmd, "room", "ROOM")
+}
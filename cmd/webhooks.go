@@ -1,12 +1,70 @@
 package cmd
 
 import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/jbogarin/go-cisco-spark/ciscospark"
 	"github.com/spf13/cobra"
 )
 
+var webhooksListenAddress, webhooksListenPath, webhooksSecret, webhooksEventsFile string
+
+// WebhookEvent is the notification posted by Spark to the target URL of a webhook
+type WebhookEvent struct {
+	ID        string      `json:"id,omitempty"`
+	Name      string      `json:"name,omitempty"`
+	TargetURL string      `json:"targetUrl,omitempty"`
+	Resource  string      `json:"resource,omitempty"`
+	Event     string      `json:"event,omitempty"`
+	Filter    string      `json:"filter,omitempty"`
+	OrgID     string      `json:"orgId,omitempty"`
+	CreatedBy string      `json:"createdBy,omitempty"`
+	AppID     string      `json:"appId,omitempty"`
+	OwnedBy   string      `json:"ownedBy,omitempty"`
+	Status    string      `json:"status,omitempty"`
+	ActorID   string      `json:"actorId,omitempty"`
+	Created   *time.Time  `json:"created,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// HydrateWebhookEvent replaces the data of attachmentActions:created events with the submitted attachment action
+func HydrateWebhookEvent(event *WebhookEvent) error {
+	if event.Resource != "attachmentActions" || event.Event != "created" {
+		return nil
+	}
+
+	data, _ := event.Data.(map[string]interface{})
+	id, _ := data["id"].(string)
+	if id == "" {
+		return fmt.Errorf("attachment action event %s has no data id", event.ID)
+	}
+
+	action, err := GetAttachmentAction(id)
+	if err != nil {
+		return err
+	}
+	event.Data = action
+	return nil
+}
+
+// checkWebhookSignature checks the X-Spark-Signature header, the HMAC-SHA1 of the body with the webhook secret
+func checkWebhookSignature(body []byte, signature, secret string) bool {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
 // webhooksCmd represents the webhooks command
 var webhooksCmd = &cobra.Command{
 	Use:   "webhooks",
@@ -51,6 +109,77 @@ Use -r/--webhook-type to define the webhook type`,
 	},
 }
 
+// webhooksListenCmd represents the webhooks listen command
+var webhooksListenCmd = &cobra.Command{
+	Use:   "listen",
+	Short: "Receive webhook events",
+	Long: `Starts an HTTP server that receives the webhook events and prints them, one JSON object per line.
+
+The attachmentActions:created events are hydrated with the submitted attachment action, including the card inputs.
+
+Use -a/--address to define the listen address and -s/--secret to check the signature of the events.
+Use -o/--out to also append the events to a file.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var eventsFile *os.File
+		if webhooksEventsFile != "" {
+			var err error
+			eventsFile, err = os.OpenFile(webhooksEventsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer eventsFile.Close()
+		}
+
+		var mutex sync.Mutex
+		http.HandleFunc(webhooksListenPath, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "POST" {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if webhooksSecret != "" && !checkWebhookSignature(body, r.Header.Get("X-Spark-Signature"), webhooksSecret) {
+				fmt.Fprintln(os.Stderr, "Rejected event with an invalid signature from", r.RemoteAddr)
+				http.Error(w, "invalid signature", http.StatusUnauthorized)
+				return
+			}
+
+			event := new(WebhookEvent)
+			if err := json.Unmarshal(body, event); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+
+			if err := HydrateWebhookEvent(event); err != nil {
+				fmt.Fprintln(os.Stderr, "Unable to hydrate event", event.ID+":", err)
+			}
+
+			eventJSON, err := json.Marshal(event)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			fmt.Println(string(eventJSON))
+			if eventsFile != nil {
+				if _, err := eventsFile.Write(append(eventJSON, '\n')); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+				}
+			}
+		})
+
+		fmt.Fprintln(os.Stderr, "Listening for webhook events on", webhooksListenAddress+webhooksListenPath)
+		log.Fatal(http.ListenAndServe(webhooksListenAddress, nil))
+	},
+}
+
 // // webhooksCreateCmd represents the webhooks POST command
 // var webhooksCreateCmd = &cobra.Command{
 // 	Use:   "create",
@@ -153,11 +282,17 @@ Use -r/--webhook-type to define the webhook type`,
 func init() {
 	RootCmd.AddCommand(webhooksCmd)
 	webhooksCmd.AddCommand(webhooksListCmd)
+	webhooksCmd.AddCommand(webhooksListenCmd)
 	// webhooksCmd.AddCommand(webhooksCreateCmd)
 	// webhooksCmd.AddCommand(webhooksUpdateCmd)
 	// webhooksCmd.AddCommand(webhooksDeleteCmd)
 	// webhooksCmd.AddCommand(webhooksGetCmd)
 
+	webhooksListenCmd.Flags().StringVarP(&webhooksListenAddress, "address", "a", ":8080", "The address to listen on.")
+	webhooksListenCmd.Flags().StringVarP(&webhooksListenPath, "path", "p", "/", "The path of the webhook target URL.")
+	webhooksListenCmd.Flags().StringVarP(&webhooksSecret, "secret", "s", "", "The webhook secret, used to check the event signatures.")
+	webhooksListenCmd.Flags().StringVarP(&webhooksEventsFile, "out", "o", "", "Append the events to this file.")
+
 	// webhooksCreateCmd.Flags().StringVarP(&webhookName, "name", "n", "", "A user-friendly name for the webhook.")
 	// webhooksCreateCmd.Flags().StringVarP(&webhookTeamID, "team", "T", "", "The ID for the team with which this webhook is associated.")
 